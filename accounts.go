@@ -25,10 +25,10 @@ type Accounts struct {
 		AccountType  string `json:"accountType"`
 		Preferred    bool   `json:"preferred"`
 		Balance      struct {
-			Balance    float64 `json:"balance"`
-			Deposit    float64 `json:"deposit"`
-			ProfitLoss float64 `json:"profitLoss"`
-			Available  float64 `json:"available"`
+			Balance    Decimal `json:"balance"`
+			Deposit    Decimal `json:"deposit"`
+			ProfitLoss Decimal `json:"profitLoss"`
+			Available  Decimal `json:"available"`
 		} `json:"balance"`
 		Currency        string `json:"currency"`
 		CanTransferFrom bool   `json:"canTransferFrom"`
@@ -49,11 +49,10 @@ func (ig *IGMarkets) GetAccounts(ctx context.Context) (*Accounts, error) {
 		return nil, fmt.Errorf("igmarkets: unable to get accounts: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, Accounts{})
+	accounts, err := do[Accounts](ctx, ig, req, 1)
 	if err != nil {
 		return nil, err
 	}
-	accounts, _ := igResponseInterface.(*Accounts)
 
 	return accounts, err
 }
@@ -67,11 +66,10 @@ func (ig *IGMarkets) GetAccountPreferences(ctx context.Context) (*AccountsPrefer
 		return nil, fmt.Errorf("igmarkets: unable to get account preferences: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, AccountsPreferences{})
+	accounts, err := do[AccountsPreferences](ctx, ig, req, 1)
 	if err != nil {
 		return nil, err
 	}
-	accounts, _ := igResponseInterface.(*AccountsPreferences)
 
 	return accounts, err
 }
@@ -28,15 +28,15 @@ type Activity struct {
 		Direction            string  `json:"direction"`
 		GoodTillDate         string  `json:"goodTillDate"`
 		GuaranteedStop       bool    `json:"guaranteedStop"`
-		Level                float64 `json:"level"`
-		LimitDistance        float64 `json:"limitDistance"`
-		LimitLevel           float64 `json:"limitLevel"`
+		Level                Decimal `json:"level"`
+		LimitDistance        Decimal `json:"limitDistance"`
+		LimitLevel           Decimal `json:"limitLevel"`
 		MarketName           string  `json:"marketName"`
-		Size                 float64 `json:"size"`
-		StopDistance         float64 `json:"stopDistance"`
-		StopLevel            float64 `json:"stopLevel"`
-		TrailingStep         float64 `json:"trailingStep"`
-		TrailingStopDistance float64 `json:"trailingStopDistance"`
+		Size                 Decimal `json:"size"`
+		StopDistance         Decimal `json:"stopDistance"`
+		StopLevel            Decimal `json:"stopLevel"`
+		TrailingStep         Decimal `json:"trailingStep"`
+		TrailingStopDistance Decimal `json:"trailingStopDistance"`
 	}
 	Epic     string       `json:"epic"`
 	Period   string       `json:"period"` // The period of the activity item, e.g. "DFB" or "02-SEP-11". This will be the expiry time/date for sprint markets, e.g. "2015-10-13T12:42:05"
@@ -99,11 +99,10 @@ func (ig *IGMarkets) GetActivity(ctx context.Context, from, to time.Time) (*Acti
 	}
 
 	endpointVersion := 3
-	igResponseInterface, err := ig.doRequest(ctx, req, endpointVersion, ActivityResponse{})
+	igResponse, err := do[ActivityResponse](ctx, ig, req, endpointVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	igResponse, _ := igResponseInterface.(*ActivityResponse)
 	return igResponse, nil
 }
@@ -0,0 +1,226 @@
+package igmarkets
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lfritz/env"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ProfileDemo - Use DemoAPIURL
+	ProfileDemo = "demo"
+	// ProfileLive - Use LiveAPIURL - Real trading!
+	ProfileLive = "live"
+)
+
+const (
+	// ConfigAuthModeOAuth - Config value for AuthModeOAuth
+	ConfigAuthModeOAuth = "oauth"
+	// ConfigAuthModeSessionTokens - Config value for AuthModeSessionTokens
+	ConfigAuthModeSessionTokens = "session"
+)
+
+const redacted = "[REDACTED]"
+
+// Duration - time.Duration read from strings like "10s" in config files
+type Duration time.Duration
+
+// UnmarshalText - Parse duration string, e.g. "1m30s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText - Format duration as string, e.g. "1m30s"
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config - Credentials and client settings for NewFromConfig()
+type Config struct {
+	Profile         string   `json:"profile" yaml:"profile"` // ProfileDemo (default) or ProfileLive
+	APIURL          string   `json:"apiUrl" yaml:"apiUrl"`   // Overrides the URL of the profile
+	APIKey          string   `json:"apiKey" yaml:"apiKey"`
+	Identifier      string   `json:"identifier" yaml:"identifier"`
+	Password        string   `json:"password" yaml:"password"`
+	AccountID       string   `json:"accountId" yaml:"accountId"`
+	EncryptPassword bool     `json:"encryptPassword" yaml:"encryptPassword"`
+	AuthMode        string   `json:"authMode" yaml:"authMode"` // ConfigAuthModeOAuth (default) or ConfigAuthModeSessionTokens
+	Timeout         Duration `json:"timeout" yaml:"timeout"`   // e.g. "10s"
+	UserAgent       string   `json:"userAgent" yaml:"userAgent"`
+	Retry           bool     `json:"retry" yaml:"retry"`         // Use DefaultRetryPolicy()
+	RateLimit       bool     `json:"rateLimit" yaml:"rateLimit"` // Use DefaultRateLimitConfig()
+}
+
+// LoadConfigFromEnv - Read config from environment variables IG_PROFILE, IG_API_URL, IG_API_KEY,
+// IG_IDENTIFIER, IG_PASSWORD, IG_ACCOUNT, IG_ENCRYPT_PASSWORD, IG_AUTH_MODE, IG_TIMEOUT,
+// IG_USER_AGENT, IG_RETRY and IG_RATE_LIMIT
+func LoadConfigFromEnv() (*Config, error) {
+	var config Config
+	var timeout string
+
+	var e = env.New()
+	e.OptionalString("IG_PROFILE", &config.Profile, ProfileDemo, "IG profile (demo or live)")
+	e.OptionalString("IG_API_URL", &config.APIURL, "", "IG API URL")
+	e.OptionalString("IG_API_KEY", &config.APIKey, "", "IG API key")
+	e.OptionalString("IG_IDENTIFIER", &config.Identifier, "", "IG Identifier")
+	e.OptionalString("IG_PASSWORD", &config.Password, "", "IG password")
+	e.OptionalString("IG_ACCOUNT", &config.AccountID, "", "IG account ID")
+	e.OptionalBool("IG_ENCRYPT_PASSWORD", &config.EncryptPassword, false, "Encrypt password on login")
+	e.OptionalString("IG_AUTH_MODE", &config.AuthMode, ConfigAuthModeOAuth, "IG auth mode (oauth or session)")
+	e.OptionalString("IG_TIMEOUT", &timeout, "", "Timeout for REST requests, e.g. 10s")
+	e.OptionalString("IG_USER_AGENT", &config.UserAgent, "", "User-Agent header")
+	e.OptionalBool("IG_RETRY", &config.Retry, false, "Retry failed requests")
+	e.OptionalBool("IG_RATE_LIMIT", &config.RateLimit, false, "Enable client-side rate limiting")
+	if err := e.Load(); err != nil {
+		return nil, fmt.Errorf("igmarkets: loading config from environment failed: %v", err)
+	}
+
+	if timeout != "" {
+		if err := config.Timeout.UnmarshalText([]byte(timeout)); err != nil {
+			return nil, fmt.Errorf("igmarkets: invalid IG_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// LoadConfigFromFile - Read config from a YAML (.yaml, .yml) or JSON (.json) file
+func LoadConfigFromFile(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to read config file: %v", err)
+	}
+
+	var config Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	default:
+		return nil, fmt.Errorf("igmarkets: unsupported config file format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to parse config file %q: %v", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate - Check required fields and apply the profile's API URL if none is given
+func (c *Config) Validate() error {
+	switch c.Profile {
+	case "":
+		c.Profile = ProfileDemo
+	case ProfileDemo, ProfileLive:
+	default:
+		return fmt.Errorf("igmarkets: invalid profile %q, must be %q or %q", c.Profile, ProfileDemo, ProfileLive)
+	}
+
+	if c.APIURL == "" {
+		c.APIURL = DemoAPIURL
+		if c.Profile == ProfileLive {
+			c.APIURL = LiveAPIURL
+		}
+	}
+
+	if _, err := c.authMode(); err != nil {
+		return err
+	}
+
+	var missing []string
+	if c.APIKey == "" {
+		missing = append(missing, "API key")
+	}
+	if c.Identifier == "" {
+		missing = append(missing, "identifier")
+	}
+	if c.Password == "" {
+		missing = append(missing, "password")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("igmarkets: config is missing %s", strings.Join(missing, ", "))
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("igmarkets: timeout must not be negative")
+	}
+	return nil
+}
+
+// String - Config with API key and password redacted, safe for logging
+func (c Config) String() string {
+	if c.APIKey != "" {
+		c.APIKey = redacted
+	}
+	if c.Password != "" {
+		c.Password = redacted
+	}
+	return fmt.Sprintf("Config{Profile:%q APIURL:%q APIKey:%q Identifier:%q Password:%q AccountID:%q "+
+		"EncryptPassword:%t AuthMode:%q Timeout:%s UserAgent:%q Retry:%t RateLimit:%t}",
+		c.Profile, c.APIURL, c.APIKey, c.Identifier, c.Password, c.AccountID,
+		c.EncryptPassword, c.AuthMode, time.Duration(c.Timeout), c.UserAgent, c.Retry, c.RateLimit)
+}
+
+// GoString - Same as String() so %#v does not leak secrets either
+func (c Config) GoString() string {
+	return c.String()
+}
+
+func (c *Config) authMode() (AuthMode, error) {
+	switch c.AuthMode {
+	case "", ConfigAuthModeOAuth:
+		return AuthModeOAuth, nil
+	case ConfigAuthModeSessionTokens:
+		return AuthModeSessionTokens, nil
+	default:
+		return AuthModeOAuth, fmt.Errorf("igmarkets: invalid auth mode %q, must be %q or %q",
+			c.AuthMode, ConfigAuthModeOAuth, ConfigAuthModeSessionTokens)
+	}
+}
+
+// NewFromConfig - Create new instance of igmarkets from config. Additional options are applied last.
+func NewFromConfig(config Config, opts ...Option) (*IGMarkets, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	authMode, _ := config.authMode()
+
+	configOpts := []Option{
+		WithBaseURL(config.APIURL),
+		WithCredentials(config.APIKey, config.Identifier, config.Password),
+		WithAccountID(config.AccountID),
+		WithAuthMode(authMode),
+		WithTimeout(time.Duration(config.Timeout)),
+	}
+	if config.EncryptPassword {
+		configOpts = append(configOpts, WithEncryptedPassword())
+	}
+	if config.UserAgent != "" {
+		configOpts = append(configOpts, WithUserAgent(config.UserAgent))
+	}
+	if config.Retry {
+		configOpts = append(configOpts, WithRetryPolicy(DefaultRetryPolicy()))
+	}
+	if config.RateLimit {
+		configOpts = append(configOpts, WithRateLimiter(NewRateLimiter(DefaultRateLimitConfig())))
+	}
+
+	return NewWithOptions(append(configOpts, opts...)...)
+}
@@ -0,0 +1,45 @@
+package igmarkets
+
+import (
+	"github.com/AMekss/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ig.yaml")
+	data := []byte("profile: live\napiKey: KEY\nidentifier: user\npassword: secret\naccountId: ABC\ntimeout: 15s\nauthMode: session\n")
+	assert.NoError(t, ioutil.WriteFile(path, data, 0600))
+
+	config, err := LoadConfigFromFile(path)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, LiveAPIURL, config.APIURL)
+	assert.True(t, time.Duration(config.Timeout) == 15*time.Second)
+	assert.False(t, strings.Contains(config.String(), "secret"))
+	assert.False(t, strings.Contains(config.String(), "KEY"))
+
+	igm, err := NewFromConfig(*config)
+	assert.NoError(t, err)
+	assert.True(t, igm.AuthMode == AuthModeSessionTokens)
+	assert.EqualStrings(t, "ABC", igm.AccountID)
+
+	config.Profile = "paper"
+	assert.True(t, config.Validate() != nil)
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("IG_API_KEY", "KEY")
+	t.Setenv("IG_IDENTIFIER", "user")
+	t.Setenv("IG_PASSWORD", "")
+
+	_, err := LoadConfigFromEnv()
+	assert.True(t, err != nil)
+
+	t.Setenv("IG_PASSWORD", "secret")
+	config, err := LoadConfigFromEnv()
+	assert.NoError(t, err)
+	assert.EqualStrings(t, DemoAPIURL, config.APIURL)
+}
@@ -0,0 +1,34 @@
+package igmarkets
+
+import (
+	"context"
+	"fmt"
+)
+
+// Dealer - Serves the dealing methods instead of IG's dealing endpoints, e.g. the paper trader of package paper.
+// All other requests, e.g. for prices, are still sent to IG.
+type Dealer interface {
+	PlaceOTCOrder(ctx context.Context, order OTCOrderRequest) (*DealReference, error)
+	UpdateOTCOrder(ctx context.Context, dealID string, order OTCUpdateOrderRequest) (*DealReference, error)
+	CloseOTCPosition(ctx context.Context, close OTCPositionCloseRequest) (*DealReference, error)
+	GetPositions(ctx context.Context) (*PositionsResponse, error)
+	PlaceOTCWorkingOrder(ctx context.Context, order OTCWorkingOrderRequest) (*DealReference, error)
+	UpdateOTCWorkingOrder(ctx context.Context, dealID string, order OTCUpdateWorkingOrderRequest) (*DealReference, error)
+	DeleteOTCWorkingOrder(ctx context.Context, dealID string) (*DealReference, error)
+	GetOTCWorkingOrders(ctx context.Context) (*WorkingOrders, error)
+	GetDealConfirmation(ctx context.Context, dealRef string) (*OTCDealConfirmation, error)
+	// OnTick - Called for every tick of OpenLightStreamerSubscription(), must not block
+	OnTick(tick LightStreamerTick)
+}
+
+// WithDealer - Serve the dealing methods of the client from the dealer, see Dealer.
+// Orders still pass the pre-flight checks of WithOrderValidation().
+func WithDealer(dealer Dealer) Option {
+	return func(ig *IGMarkets) error {
+		if dealer == nil {
+			return fmt.Errorf("igmarkets: dealer must not be nil")
+		}
+		ig.dealer = dealer
+		return nil
+	}
+}
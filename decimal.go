@@ -0,0 +1,464 @@
+package igmarkets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalScale - Decimal keeps at most 18 digits after the decimal point
+const maxDecimalScale = 18
+
+// pow10 - Powers of ten that fit into an int64
+var pow10 = [maxDecimalScale + 1]int64{
+	1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18,
+}
+
+// Decimal - Exact decimal number used for levels, distances, sizes and amounts.
+// Arithmetic is exact within 18 significant digits, beyond that it falls back to float64 precision
+// (see CheckedAdd() and CheckedMul()). The zero value is unset and encoded as JSON null,
+// which IG treats like an omitted field.
+type Decimal struct {
+	coefficient int64
+	scale       int32 // Digits after the decimal point: value = coefficient / 10^scale
+	set         bool
+}
+
+// NewDecimal - Decimal with the value coefficient / 10^scale, e.g. NewDecimal(11002, 4) is 1.1002
+func NewDecimal(coefficient int64, scale int32) Decimal {
+	d := Decimal{coefficient: coefficient, set: true}
+	for scale < 0 {
+		d.coefficient *= 10
+		scale++
+	}
+	d.scale = scale
+	if d.scale > maxDecimalScale {
+		d = d.roundScale(maxDecimalScale)
+	}
+	return d.normalize()
+}
+
+// DecimalFromFloat - Shortest decimal that converts back to the same float64, e.g. 0.1 is exactly 0.1.
+// NaN and infinity return an unset Decimal.
+func DecimalFromFloat(f float64) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}
+	}
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+// ParseDecimal - Parse a decimal string like "-1.25", "+3" or "1.5e-3"
+func ParseDecimal(s string) (Decimal, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return Decimal{}, fmt.Errorf("igmarkets: invalid decimal %q", s)
+	}
+
+	negative := false
+	switch value[0] {
+	case '-':
+		negative = true
+		value = value[1:]
+	case '+':
+		value = value[1:]
+	}
+
+	mantissa, exponent := value, ""
+	if i := strings.IndexAny(value, "eE"); i >= 0 {
+		mantissa, exponent = value[:i], value[i+1:]
+	}
+
+	var coefficient int64
+	var scale int32
+	digits, point, roundUp, dropped := 0, false, false, false
+	for i := 0; i < len(mantissa); i++ {
+		c := mantissa[i]
+		if c == '.' && !point {
+			point = true
+			continue
+		}
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("igmarkets: invalid decimal %q", s)
+		}
+		digits++
+		digit := int64(c - '0')
+		if dropped || (point && scale >= maxDecimalScale) || coefficient > (math.MaxInt64-digit)/10 {
+			if !point {
+				return Decimal{}, fmt.Errorf("igmarkets: decimal %q out of range", s)
+			}
+			// Fractional digits beyond the precision are rounded half away from zero
+			if !dropped {
+				roundUp = digit >= 5
+				dropped = true
+			}
+			continue
+		}
+		coefficient = coefficient*10 + digit
+		if point {
+			scale++
+		}
+	}
+	if digits == 0 {
+		return Decimal{}, fmt.Errorf("igmarkets: invalid decimal %q", s)
+	}
+	if roundUp {
+		coefficient++
+	}
+	if negative {
+		coefficient = -coefficient
+	}
+
+	if exponent != "" {
+		shift, err := strconv.ParseInt(exponent, 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("igmarkets: invalid decimal %q", s)
+		}
+		d, ok := Decimal{coefficient: coefficient, scale: scale, set: true}.shift(int32(shift))
+		if !ok {
+			return Decimal{}, fmt.Errorf("igmarkets: decimal %q out of range", s)
+		}
+		return d, nil
+	}
+	return Decimal{coefficient: coefficient, scale: scale, set: true}.normalize(), nil
+}
+
+// IsSet - False for the zero value, which is encoded as JSON null
+func (d Decimal) IsSet() bool {
+	return d.set
+}
+
+// IsZero - True if the value is zero or unset
+func (d Decimal) IsZero() bool {
+	return d.coefficient == 0
+}
+
+// Sign - -1, 0 or +1
+func (d Decimal) Sign() int {
+	switch {
+	case d.coefficient < 0:
+		return -1
+	case d.coefficient > 0:
+		return 1
+	}
+	return 0
+}
+
+// Float64 - Nearest float64, 0 if unset
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String - Plain decimal notation without trailing zeros, "" if unset
+func (d Decimal) String() string {
+	if !d.set {
+		return ""
+	}
+	digits := strconv.FormatInt(d.coefficient, 10)
+	if d.scale == 0 {
+		return digits
+	}
+	sign := ""
+	if digits[0] == '-' {
+		sign, digits = "-", digits[1:]
+	}
+	if len(digits) <= int(d.scale) {
+		digits = strings.Repeat("0", int(d.scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Places - Number of digits after the decimal point, e.g. 2 for 0.25
+func (d Decimal) Places() int32 {
+	return d.scale
+}
+
+// Neg - Negated value
+func (d Decimal) Neg() Decimal {
+	d.coefficient = -d.coefficient
+	return d
+}
+
+// Abs - Absolute value
+func (d Decimal) Abs() Decimal {
+	if d.coefficient < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Add - d + other. If the exact sum overflows, the result is computed in float64 precision and
+// clamped to the int64 range, see CheckedAdd(). It is set if d or other is set.
+func (d Decimal) Add(other Decimal) Decimal {
+	sum, err := d.CheckedAdd(other)
+	if err != nil {
+		return approximate(d.Float64()+other.Float64(), true)
+	}
+	return sum
+}
+
+// CheckedAdd - d + other, ErrDecimalOverflow if the sum cannot be represented exactly
+func (d Decimal) CheckedAdd(other Decimal) (Decimal, error) {
+	a, b, scale, ok := align(d, other)
+	if ok && (b <= 0 || a <= math.MaxInt64-b) && (b >= 0 || a >= math.MinInt64-b) {
+		return Decimal{coefficient: a + b, scale: scale, set: d.set || other.set}.normalize(), nil
+	}
+	return Decimal{}, fmt.Errorf("%w: %v + %v", ErrDecimalOverflow, d, other)
+}
+
+// Sub - d - other, see Add()
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d.Add(other.Neg())
+}
+
+// Mul - d * other, rounded to 18 digits after the decimal point. If the product overflows, it is computed
+// in float64 precision and clamped to the int64 range like Add(), see CheckedMul().
+func (d Decimal) Mul(other Decimal) Decimal {
+	product, err := d.CheckedMul(other)
+	if err != nil {
+		return approximate(d.Float64()*other.Float64(), true)
+	}
+	return product
+}
+
+// CheckedMul - d * other rounded like Mul(), ErrDecimalOverflow if the product cannot be represented exactly
+func (d Decimal) CheckedMul(other Decimal) (Decimal, error) {
+	set := d.set || other.set
+	if d.coefficient == 0 || other.coefficient == 0 {
+		return Decimal{set: set}, nil
+	}
+	product := d.coefficient * other.coefficient
+	if product/other.coefficient == d.coefficient && product != math.MinInt64 {
+		result := Decimal{coefficient: product, scale: d.scale + other.scale, set: set}
+		if result.scale > maxDecimalScale {
+			result = result.roundScale(maxDecimalScale)
+		}
+		return result.normalize(), nil
+	}
+	return Decimal{}, fmt.Errorf("%w: %v * %v", ErrDecimalOverflow, d, other)
+}
+
+// Cmp - -1 if d < other, 0 if equal and +1 if d > other
+func (d Decimal) Cmp(other Decimal) int {
+	a, b, _, ok := align(d, other)
+	if !ok {
+		return compareFloat64(d.Float64(), other.Float64())
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Equal - Same value, regardless of whether it is set
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+// Round - Round half away from zero to the given number of decimal places
+func (d Decimal) Round(places int32) Decimal {
+	if places < 0 {
+		places = 0
+	}
+	if places >= d.scale {
+		return d
+	}
+	return d.roundScale(places).normalize()
+}
+
+// Truncate - Round toward zero to the given number of decimal places
+func (d Decimal) Truncate(places int32) Decimal {
+	if places < 0 {
+		places = 0
+	}
+	if places >= d.scale {
+		return d
+	}
+	return Decimal{coefficient: d.coefficient / pow10[d.scale-places], scale: places, set: d.set}.normalize()
+}
+
+// Shift - d * 10^places, e.g. 1.5 shifted by 2 is 150. Overflows are handled like in Add().
+func (d Decimal) Shift(places int32) Decimal {
+	if shifted, ok := d.shift(places); ok {
+		return shifted
+	}
+	return approximate(d.Float64()*math.Pow10(int(places)), d.set)
+}
+
+// MarshalJSON - JSON number, null if unset
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if !d.set {
+		return []byte("null"), nil
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON - Accept numbers, numeric strings and currency prefixed amounts like "E-12.34" or "£1,234.50".
+// null and empty strings leave the Decimal unset.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+
+	value := string(data)
+	if data[0] == '"' {
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("igmarkets: invalid decimal %s: %v", data, err)
+		}
+		if value = strings.TrimSpace(value); value == "" || value == "-" {
+			*d = Decimal{}
+			return nil
+		}
+		value = trimAmount(value)
+	}
+
+	parsed, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// trimAmount - Strip the currency prefix and thousands separators of amounts like "-E1,234.5"
+func trimAmount(value string) string {
+	sign := ""
+	if strings.HasPrefix(value, "-") {
+		sign, value = "-", value[1:]
+	}
+	value = strings.TrimLeftFunc(value, func(r rune) bool {
+		return !(r >= '0' && r <= '9') && r != '-' && r != '+' && r != '.'
+	})
+	return sign + strings.ReplaceAll(value, ",", "")
+}
+
+// RoundLevel - Round a level to the instrument's decimal places (DecimalPlacesFactor)
+func (s Snapshot) RoundLevel(level Decimal) Decimal {
+	return level.Round(int32(s.DecimalPlacesFactor))
+}
+
+// UnscaleLevel - Convert a level to the underlying's price by dividing by ScalingFactor,
+// e.g. 11000.5 with a scaling factor of 10000 is 1.10005. Exact for factors that are powers of ten.
+func (s Snapshot) UnscaleLevel(level Decimal) Decimal {
+	if s.ScalingFactor == 0 || s.ScalingFactor == 1 {
+		return level
+	}
+	places := math.Log10(s.ScalingFactor)
+	if places == math.Trunc(places) {
+		return level.Shift(-int32(places))
+	}
+	return DecimalFromFloat(level.Float64() / s.ScalingFactor)
+}
+
+// normalize - Strip trailing zeros so equal values compare equal with ==
+func (d Decimal) normalize() Decimal {
+	for d.scale > 0 && d.coefficient%10 == 0 {
+		d.coefficient /= 10
+		d.scale--
+	}
+	if d.coefficient == 0 {
+		d.scale = 0
+	}
+	return d
+}
+
+// roundScale - Round half away from zero to fewer digits after the decimal point
+func (d Decimal) roundScale(scale int32) Decimal {
+	diff := d.scale - scale
+	if diff > maxDecimalScale {
+		return Decimal{set: d.set}
+	}
+	divisor := pow10[diff]
+	quotient, remainder := d.coefficient/divisor, d.coefficient%divisor
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder >= divisor-remainder {
+		if d.coefficient < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return Decimal{coefficient: quotient, scale: scale, set: d.set}
+}
+
+// shift - d * 10^places, false on overflow
+func (d Decimal) shift(places int32) (Decimal, bool) {
+	scale := int64(d.scale) - int64(places)
+	if scale > 2*maxDecimalScale {
+		return Decimal{set: d.set}, true
+	}
+	if scale > maxDecimalScale {
+		return Decimal{coefficient: d.coefficient, scale: int32(scale), set: d.set}.roundScale(maxDecimalScale).normalize(), true
+	}
+	if scale >= 0 {
+		return Decimal{coefficient: d.coefficient, scale: int32(scale), set: d.set}.normalize(), true
+	}
+	coefficient, ok := mulPow10(d.coefficient, int32(-scale))
+	return Decimal{coefficient: coefficient, set: d.set}, ok
+}
+
+// align - Coefficients of a and b with the same scale
+func align(a, b Decimal) (int64, int64, int32, bool) {
+	switch {
+	case a.scale < b.scale:
+		coefficient, ok := mulPow10(a.coefficient, b.scale-a.scale)
+		return coefficient, b.coefficient, b.scale, ok
+	case a.scale > b.scale:
+		coefficient, ok := mulPow10(b.coefficient, a.scale-b.scale)
+		return a.coefficient, coefficient, a.scale, ok
+	}
+	return a.coefficient, b.coefficient, a.scale, true
+}
+
+// mulPow10 - coefficient * 10^n, false on overflow
+func mulPow10(coefficient int64, n int32) (int64, bool) {
+	if coefficient == 0 {
+		return 0, true
+	}
+	if n > maxDecimalScale {
+		return 0, false
+	}
+	factor := pow10[n]
+	if coefficient > math.MaxInt64/factor || coefficient < math.MinInt64/factor {
+		return 0, false
+	}
+	return coefficient * factor, true
+}
+
+// approximate - Fallback of overflowing operations: f in float64 precision, clamped to the int64 range
+func approximate(f float64, set bool) Decimal {
+	if d := DecimalFromFloat(f); d.IsSet() || !set {
+		return d
+	}
+	if f < 0 {
+		return Decimal{coefficient: -math.MaxInt64, set: true}
+	}
+	return Decimal{coefficient: math.MaxInt64, set: true}
+}
+
+// compareFloat64 - -1, 0 or +1
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package igmarkets
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/AMekss/assert"
+	"testing"
+)
+
+func TestDecimal(t *testing.T) {
+	level := DecimalFromFloat(1.1002)
+	assert.EqualStrings(t, "1.0952", level.Sub(DecimalFromFloat(0.005)).String())
+	assert.EqualStrings(t, "0.3", DecimalFromFloat(0.1).Add(DecimalFromFloat(0.2)).String())
+	assert.EqualStrings(t, "-0.0001", DecimalFromFloat(-0.0002).Mul(DecimalFromFloat(0.5)).String())
+	assert.EqualStrings(t, "1.1002", NewDecimal(11002, 4).String())
+	assert.EqualStrings(t, "1500", NewDecimal(15, -2).String())
+	assert.True(t, NewDecimal(10, 1) == DecimalFromFloat(1))
+
+	for input, expected := range map[string]string{
+		"1.10":                  "1.1",
+		"-0.05":                 "-0.05",
+		"+3":                    "3",
+		"1.5e-3":                "0.0015",
+		"2E2":                   "200",
+		"0.1234567890123456789": "0.123456789012345679",
+	} {
+		parsed, err := ParseDecimal(input)
+		assert.NoError(t, err)
+		assert.EqualStrings(t, expected, parsed.String())
+	}
+	for _, input := range []string{"", "-", "1.2.3", "abc", "99999999999999999999"} {
+		_, err := ParseDecimal(input)
+		assert.True(t, err != nil)
+	}
+
+	assert.EqualStrings(t, "1.1", DecimalFromFloat(1.149).Round(1).String())
+	assert.EqualStrings(t, "1.2", DecimalFromFloat(1.15).Round(1).String())
+	assert.EqualStrings(t, "-1.2", DecimalFromFloat(-1.15).Round(1).String())
+	assert.EqualStrings(t, "1.1", DecimalFromFloat(1.19).Truncate(1).String())
+	assert.EqualStrings(t, "-1", DecimalFromFloat(-1.99).Truncate(0).String())
+	assert.EqualInt(t, -1, DecimalFromFloat(1.1).Cmp(DecimalFromFloat(1.11)))
+	assert.EqualInt(t, 0, DecimalFromFloat(1.1).Cmp(NewDecimal(110, 2)))
+	assert.EqualFloat64(t, 1.1002, level.Float64())
+	assert.False(t, Decimal{}.IsSet())
+	assert.True(t, DecimalFromFloat(0).IsSet())
+
+	// Overflows fall back to float64 precision and stay set
+	_, err := NewDecimal(1, 18).CheckedAdd(DecimalFromFloat(10))
+	assert.True(t, errors.Is(err, ErrDecimalOverflow))
+	assert.EqualStrings(t, "10", NewDecimal(1, 18).Add(DecimalFromFloat(10)).String())
+	_, err = DecimalFromFloat(1e10).CheckedMul(DecimalFromFloat(1e10))
+	assert.True(t, errors.Is(err, ErrDecimalOverflow))
+	product := DecimalFromFloat(1e10).Mul(DecimalFromFloat(-1e10))
+	assert.True(t, product.IsSet())
+	assert.EqualStrings(t, "-9223372036854775807", product.String())
+	data, err := json.Marshal(DecimalFromFloat(1e18).Shift(2))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "9223372036854775807", string(data))
+
+	snapshot := Snapshot{DecimalPlacesFactor: 1, ScalingFactor: 10000}
+	assert.EqualStrings(t, "11000.5", snapshot.RoundLevel(DecimalFromFloat(11000.46)).String())
+	assert.EqualStrings(t, "1.10005", snapshot.UnscaleLevel(DecimalFromFloat(11000.5)).String())
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var transaction Transaction
+	assert.NoError(t, json.Unmarshal([]byte(`{"openLevel":"1.10020","closeLevel":1.1039,
+		"profitAndLoss":"E-1,234.50","size":"-"}`), &transaction))
+	assert.EqualStrings(t, "1.1002", transaction.OpenLevel.String())
+	assert.EqualStrings(t, "1.1039", transaction.CloseLevel.String())
+	assert.EqualStrings(t, "-1234.5", transaction.ProfitAndLoss.String())
+	assert.False(t, transaction.Size.IsSet())
+
+	for input, expected := range map[string]string{
+		`"£15.34"`: "15.34",
+		`"-$0.5"`:  "-0.5",
+		`"A$-2"`:   "-2",
+	} {
+		var amount Decimal
+		assert.NoError(t, json.Unmarshal([]byte(input), &amount))
+		assert.EqualStrings(t, expected, amount.String())
+	}
+	var amount Decimal
+	assert.True(t, json.Unmarshal([]byte(`"n/a"`), &amount) != nil)
+	assert.True(t, json.Unmarshal([]byte(`true`), &amount) != nil)
+
+	// Unset fields are sent as null, zero values as 0
+	data, err := json.Marshal(OTCUpdateOrderRequest{LimitLevel: DecimalFromFloat(0), StopLevel: DecimalFromFloat(1.0952)})
+	assert.NoError(t, err)
+	assert.EqualStrings(t, `{"stopLevel":1.0952,"limitLevel":0,"trailingStop":false,"trailingStopIncrement":null}`, string(data))
+}
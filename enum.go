@@ -0,0 +1,271 @@
+package igmarkets
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Direction - Deal direction of orders and positions
+type Direction string
+
+// Directions
+const (
+	DirectionBuy  Direction = "BUY"
+	DirectionSell Direction = "SELL"
+)
+
+// Opposite - Direction closing a position of this direction, e.g. for OTCPositionCloseRequest
+func (d Direction) Opposite() Direction {
+	switch d {
+	case DirectionBuy:
+		return DirectionSell
+	case DirectionSell:
+		return DirectionBuy
+	default:
+		return d
+	}
+}
+
+func (d Direction) valid() bool {
+	return d == DirectionBuy || d == DirectionSell
+}
+
+// MarshalJSON - Fails for unknown values
+func (d Direction) MarshalJSON() ([]byte, error) {
+	return marshalEnum("direction", d)
+}
+
+// UnmarshalJSON - Keeps unknown values, see SchemaDrift.UnknownValues
+func (d *Direction) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum("direction", data, d)
+}
+
+// OrderType - Type of OTC orders
+type OrderType string
+
+// Order types
+const (
+	OrderTypeLimit  OrderType = "LIMIT"
+	OrderTypeMarket OrderType = "MARKET"
+	OrderTypeQuote  OrderType = "QUOTE"
+)
+
+func (t OrderType) valid() bool {
+	return t == OrderTypeLimit || t == OrderTypeMarket || t == OrderTypeQuote
+}
+
+// MarshalJSON - Fails for unknown values
+func (t OrderType) MarshalJSON() ([]byte, error) {
+	return marshalEnum("order type", t)
+}
+
+// UnmarshalJSON - Keeps unknown values, see SchemaDrift.UnknownValues
+func (t *OrderType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum("order type", data, t)
+}
+
+// WorkingOrderType - Type of working orders
+type WorkingOrderType string
+
+// Working order types
+const (
+	WorkingOrderTypeLimit WorkingOrderType = "LIMIT"
+	WorkingOrderTypeStop  WorkingOrderType = "STOP"
+)
+
+func (t WorkingOrderType) valid() bool {
+	return t == WorkingOrderTypeLimit || t == WorkingOrderTypeStop
+}
+
+// MarshalJSON - Fails for unknown values
+func (t WorkingOrderType) MarshalJSON() ([]byte, error) {
+	return marshalEnum("working order type", t)
+}
+
+// UnmarshalJSON - Keeps unknown values, see SchemaDrift.UnknownValues
+func (t *WorkingOrderType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum("working order type", data, t)
+}
+
+// TimeInForce - Lifetime of orders and working orders
+type TimeInForce string
+
+// Time in force values; orders use EXECUTE_AND_ELIMINATE or FILL_OR_KILL,
+// working orders GOOD_TILL_CANCELLED or GOOD_TILL_DATE
+const (
+	TimeInForceExecuteAndEliminate TimeInForce = "EXECUTE_AND_ELIMINATE"
+	TimeInForceFillOrKill          TimeInForce = "FILL_OR_KILL"
+	TimeInForceGoodTillCancelled   TimeInForce = "GOOD_TILL_CANCELLED"
+	TimeInForceGoodTillDate        TimeInForce = "GOOD_TILL_DATE"
+)
+
+func (t TimeInForce) valid() bool {
+	switch t {
+	case TimeInForceExecuteAndEliminate, TimeInForceFillOrKill, TimeInForceGoodTillCancelled, TimeInForceGoodTillDate:
+		return true
+	default:
+		return false
+	}
+}
+
+// MarshalJSON - Fails for unknown values
+func (t TimeInForce) MarshalJSON() ([]byte, error) {
+	return marshalEnum("time in force", t)
+}
+
+// UnmarshalJSON - Keeps unknown values, see SchemaDrift.UnknownValues
+func (t *TimeInForce) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum("time in force", data, t)
+}
+
+// DealStatus - Outcome of a deal, see OTCDealConfirmation
+type DealStatus string
+
+// Deal status values
+const (
+	DealStatusAccepted DealStatus = "ACCEPTED"
+	DealStatusRejected DealStatus = "REJECTED"
+)
+
+func (s DealStatus) valid() bool {
+	return s == DealStatusAccepted || s == DealStatusRejected
+}
+
+// MarshalJSON - Fails for unknown values
+func (s DealStatus) MarshalJSON() ([]byte, error) {
+	return marshalEnum("deal status", s)
+}
+
+// UnmarshalJSON - Keeps unknown values, see SchemaDrift.UnknownValues
+func (s *DealStatus) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum("deal status", data, s)
+}
+
+// PositionStatus - Status of the position or working order after an accepted deal, see OTCDealConfirmation
+type PositionStatus string
+
+// Position status values
+const (
+	PositionStatusAmended         PositionStatus = "AMENDED"
+	PositionStatusClosed          PositionStatus = "CLOSED"
+	PositionStatusDeleted         PositionStatus = "DELETED"
+	PositionStatusOpen            PositionStatus = "OPEN"
+	PositionStatusPartiallyClosed PositionStatus = "PARTIALLY_CLOSED"
+)
+
+func (s PositionStatus) valid() bool {
+	switch s {
+	case PositionStatusAmended, PositionStatusClosed, PositionStatusDeleted, PositionStatusOpen, PositionStatusPartiallyClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+// MarshalJSON - Fails for unknown values
+func (s PositionStatus) MarshalJSON() ([]byte, error) {
+	return marshalEnum("position status", s)
+}
+
+// UnmarshalJSON - Keeps unknown values, see SchemaDrift.UnknownValues
+func (s *PositionStatus) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum("position status", data, s)
+}
+
+// DealReason - Reason code of a deal confirmation. Not validated, IG adds new codes from time to time.
+type DealReason string
+
+// Deal reasons
+const (
+	DealReasonAccountNotEnabledToTrading               DealReason = "ACCOUNT_NOT_ENABLED_TO_TRADING"
+	DealReasonAttachedOrderLevelError                  DealReason = "ATTACHED_ORDER_LEVEL_ERROR"
+	DealReasonAttachedOrderTrailingStopError           DealReason = "ATTACHED_ORDER_TRAILING_STOP_ERROR"
+	DealReasonCannotChangeStopType                     DealReason = "CANNOT_CHANGE_STOP_TYPE"
+	DealReasonCannotRemoveStop                         DealReason = "CANNOT_REMOVE_STOP"
+	DealReasonClosingsOnlyAccount                      DealReason = "CLOSINGS_ONLY_ACCOUNT"
+	DealReasonClosingOnlyTradesAcceptedOnThisMarket    DealReason = "CLOSING_ONLY_TRADES_ACCEPTED_ON_THIS_MARKET"
+	DealReasonConflictingOrder                         DealReason = "CONFLICTING_ORDER"
+	DealReasonContactSupportInstrumentError            DealReason = "CONTACT_SUPPORT_INSTRUMENT_ERROR"
+	DealReasonCRSpacing                                DealReason = "CR_SPACING"
+	DealReasonDuplicateOrderError                      DealReason = "DUPLICATE_ORDER_ERROR"
+	DealReasonExchangeManualOverride                   DealReason = "EXCHANGE_MANUAL_OVERRIDE"
+	DealReasonExpiryLessThanSprintMarketMinExpiry      DealReason = "EXPIRY_LESS_THAN_SPRINT_MARKET_MIN_EXPIRY"
+	DealReasonFinanceRepeatDealing                     DealReason = "FINANCE_REPEAT_DEALING"
+	DealReasonForceOpenOnSameMarketDifferentCurrency   DealReason = "FORCE_OPEN_ON_SAME_MARKET_DIFFERENT_CURRENCY"
+	DealReasonGeneralError                             DealReason = "GENERAL_ERROR"
+	DealReasonGoodTillDateInThePast                    DealReason = "GOOD_TILL_DATE_IN_THE_PAST"
+	DealReasonInstrumentNotFound                       DealReason = "INSTRUMENT_NOT_FOUND"
+	DealReasonInstrumentNotTradeableInThisCurrency     DealReason = "INSTRUMENT_NOT_TRADEABLE_IN_THIS_CURRENCY"
+	DealReasonInstrumentNotValid                       DealReason = "INSTRUMENT_NOT_VALID"
+	DealReasonInsufficientFunds                        DealReason = "INSUFFICIENT_FUNDS"
+	DealReasonLevelToleranceError                      DealReason = "LEVEL_TOLERANCE_ERROR"
+	DealReasonLimitOrderWrongSideOfMarket              DealReason = "LIMIT_ORDER_WRONG_SIDE_OF_MARKET"
+	DealReasonManualOrderTimeout                       DealReason = "MANUAL_ORDER_TIMEOUT"
+	DealReasonMarginError                              DealReason = "MARGIN_ERROR"
+	DealReasonMarketClosed                             DealReason = "MARKET_CLOSED"
+	DealReasonMarketClosedWithEdits                    DealReason = "MARKET_CLOSED_WITH_EDITS"
+	DealReasonMarketClosing                            DealReason = "MARKET_CLOSING"
+	DealReasonMarketNotBorrowable                      DealReason = "MARKET_NOT_BORROWABLE"
+	DealReasonMarketOffline                            DealReason = "MARKET_OFFLINE"
+	DealReasonMarketOrdersNotAllowedOnInstrument       DealReason = "MARKET_ORDERS_NOT_ALLOWED_ON_INSTRUMENT"
+	DealReasonMarketPhoneOnly                          DealReason = "MARKET_PHONE_ONLY"
+	DealReasonMarketRolled                             DealReason = "MARKET_ROLLED"
+	DealReasonMarketUnavailableToClient                DealReason = "MARKET_UNAVAILABLE_TO_CLIENT"
+	DealReasonMaxAutoSizeExceeded                      DealReason = "MAX_AUTO_SIZE_EXCEEDED"
+	DealReasonMinimumOrderSizeError                    DealReason = "MINIMUM_ORDER_SIZE_ERROR"
+	DealReasonMoveAwayOnlyLimit                        DealReason = "MOVE_AWAY_ONLY_LIMIT"
+	DealReasonMoveAwayOnlyStop                         DealReason = "MOVE_AWAY_ONLY_STOP"
+	DealReasonMoveAwayOnlyTriggerLevel                 DealReason = "MOVE_AWAY_ONLY_TRIGGER_LEVEL"
+	DealReasonNCRPositionsOnCRAccount                  DealReason = "NCR_POSITIONS_ON_CR_ACCOUNT"
+	DealReasonOpposingDirectionOrdersNotAllowed        DealReason = "OPPOSING_DIRECTION_ORDERS_NOT_ALLOWED"
+	DealReasonOpposingPositionsNotAllowed              DealReason = "OPPOSING_POSITIONS_NOT_ALLOWED"
+	DealReasonOrderDeclined                            DealReason = "ORDER_DECLINED"
+	DealReasonOrderLocked                              DealReason = "ORDER_LOCKED"
+	DealReasonOrderNotFound                            DealReason = "ORDER_NOT_FOUND"
+	DealReasonOrderSizeCannotBeFilled                  DealReason = "ORDER_SIZE_CANNOT_BE_FILLED"
+	DealReasonOverNormalMarketSize                     DealReason = "OVER_NORMAL_MARKET_SIZE"
+	DealReasonPartiallyClosedPositionNotDeleted        DealReason = "PARTIALY_CLOSED_POSITION_NOT_DELETED"
+	DealReasonPositionAlreadyExistsInOppositeDirection DealReason = "POSITION_ALREADY_EXISTS_IN_OPPOSITE_DIRECTION"
+	DealReasonPositionNotAvailableToCancel             DealReason = "POSITION_NOT_AVAILABLE_TO_CANCEL"
+	DealReasonPositionNotAvailableToClose              DealReason = "POSITION_NOT_AVAILABLE_TO_CLOSE"
+	DealReasonPositionNotFound                         DealReason = "POSITION_NOT_FOUND"
+	DealReasonRejectCFDOrderOnSpreadbetAccount         DealReason = "REJECT_CFD_ORDER_ON_SPREADBET_ACCOUNT"
+	DealReasonRejectSpreadbetOrderOnCFDAccount         DealReason = "REJECT_SPREADBET_ORDER_ON_CFD_ACCOUNT"
+	DealReasonSizeIncrement                            DealReason = "SIZE_INCREMENT"
+	DealReasonSprintMarketExpiryAfterMarketClose       DealReason = "SPRINT_MARKET_EXPIRY_AFTER_MARKET_CLOSE"
+	DealReasonStopOrLimitNotAllowed                    DealReason = "STOP_OR_LIMIT_NOT_ALLOWED"
+	DealReasonStopRequiredError                        DealReason = "STOP_REQUIRED_ERROR"
+	DealReasonStrikeLevelTolerance                     DealReason = "STRIKE_LEVEL_TOLERANCE"
+	DealReasonSuccess                                  DealReason = "SUCCESS"
+	DealReasonTrailingStopNotAllowed                   DealReason = "TRAILING_STOP_NOT_ALLOWED"
+	DealReasonUnknown                                  DealReason = "UNKNOWN"
+	DealReasonWrongSideOfMarket                        DealReason = "WRONG_SIDE_OF_MARKET"
+)
+
+// enum - Named string type with a fixed set of values
+type enum interface {
+	~string
+	valid() bool
+}
+
+// marshalEnum - Encode value as JSON string; the empty value is allowed for unset fields
+func marshalEnum[T enum](kind string, value T) ([]byte, error) {
+	if value != "" && !value.valid() {
+		return nil, fmt.Errorf("igmarkets: invalid %s %q", kind, string(value))
+	}
+	return json.Marshal(string(value))
+}
+
+// unmarshalEnum - Decode a JSON string into value; null and the empty string leave it unset.
+// Values added by IG after this client was released are kept, so responses of deals already done still decode.
+func unmarshalEnum[T enum](kind string, data []byte, value *T) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("igmarkets: invalid %s %s: %v", kind, data, err)
+	}
+	*value = T(s)
+	return nil
+}
@@ -0,0 +1,39 @@
+package igmarkets
+
+import (
+	"encoding/json"
+	"github.com/AMekss/assert"
+	"testing"
+)
+
+func TestEnumJSON(t *testing.T) {
+	data, err := json.Marshal(OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: DirectionSell, OrderType: OrderTypeMarket})
+	assert.NoError(t, err)
+	var order map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &order))
+	assert.EqualStrings(t, "SELL", order["direction"].(string))
+	_, hasTimeInForce := order["timeInForce"]
+	assert.False(t, hasTimeInForce)
+
+	// Typos fail before the request is sent
+	_, err = json.Marshal(OTCOrderRequest{Direction: "buy"})
+	assert.True(t, err != nil)
+	_, err = json.Marshal(OTCWorkingOrderRequest{Direction: DirectionBuy, Type: "MARKET"})
+	assert.True(t, err != nil)
+
+	var confirm OTCDealConfirmation
+	assert.NoError(t, json.Unmarshal([]byte(`{"direction":"BUY","dealStatus":"REJECTED","status":null,
+		"orderType":"","reason":"SOME_NEW_REASON"}`), &confirm))
+	assert.EqualStrings(t, "BUY", string(confirm.Direction))
+	assert.EqualStrings(t, "", string(confirm.Status))
+	assert.EqualStrings(t, "SOME_NEW_REASON", string(confirm.Reason))
+
+	// Unknown values in responses are kept
+	assert.NoError(t, json.Unmarshal([]byte(`{"dealStatus":"PENDING","status":"SOMETHING_NEW"}`), &confirm))
+	assert.EqualStrings(t, "PENDING", string(confirm.DealStatus))
+	assert.EqualStrings(t, "SOMETHING_NEW", string(confirm.Status))
+	assert.True(t, json.Unmarshal([]byte(`{"direction":1}`), &confirm) != nil)
+
+	assert.EqualStrings(t, "SELL", string(DirectionBuy.Opposite()))
+	assert.EqualStrings(t, "BUY", string(DirectionSell.Opposite()))
+}
@@ -0,0 +1,126 @@
+package igmarkets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentinel errors - Use errors.Is() to check the error returned by any method
+// of IGMarkets against one of these values.
+var (
+	// ErrRateLimited - IG rejected the request because an API key or account allowance was exceeded
+	ErrRateLimited = errors.New("igmarkets: request allowance exceeded")
+	// ErrHistoricalDataAllowanceExceeded - the weekly historical price data allowance is used up
+	ErrHistoricalDataAllowanceExceeded = errors.New("igmarkets: historical price data allowance exceeded")
+	// ErrInvalidCredentials - identifier, password or API key were rejected
+	ErrInvalidCredentials = errors.New("igmarkets: invalid credentials")
+	// ErrTokenInvalid - OAuth access token or CST/X-SECURITY-TOKEN is invalid or expired
+	ErrTokenInvalid = errors.New("igmarkets: session token invalid")
+	// ErrMarketClosed - the market is closed for dealing
+	ErrMarketClosed = errors.New("igmarkets: market closed")
+	// ErrEpicUnavailable - the given epic is unknown or not available
+	ErrEpicUnavailable = errors.New("igmarkets: epic unavailable")
+	// ErrDealNotFound - no deal confirmation (yet) for the given deal reference
+	ErrDealNotFound = errors.New("igmarkets: deal not found")
+	// ErrAccountNotFound - the given account ID does not belong to the client
+	ErrAccountNotFound = errors.New("igmarkets: account not found")
+	// ErrDealRejected - the deal confirmation has dealStatus REJECTED, see DealRejectedError
+	ErrDealRejected = errors.New("igmarkets: deal rejected")
+	// ErrInvalidOrder - the order violates the dealing rules of its market, see OrderValidationError
+	ErrInvalidOrder = errors.New("igmarkets: invalid order")
+	// ErrDecimalOverflow - the result of Decimal.CheckedAdd() or Decimal.CheckedMul() cannot be represented exactly
+	ErrDecimalOverflow = errors.New("igmarkets: decimal overflow")
+)
+
+// errorCodeSentinels maps IG's errorCode values to the sentinel errors above.
+var errorCodeSentinels = map[string]error{
+	"error.public-api.exceeded-api-key-allowance":                 ErrRateLimited,
+	"error.public-api.exceeded-account-allowance":                 ErrRateLimited,
+	"error.public-api.exceeded-account-trading-allowance":         ErrRateLimited,
+	"error.public-api.exceeded-account-historical-data-allowance": ErrHistoricalDataAllowanceExceeded,
+	"error.security.invalid-details":                              ErrInvalidCredentials,
+	"error.security.api-key-invalid":                              ErrInvalidCredentials,
+	"error.security.invalid-application":                          ErrInvalidCredentials,
+	"error.security.oauth-token-invalid":                          ErrTokenInvalid,
+	"error.security.client-token-invalid":                         ErrTokenInvalid,
+	"error.security.account-token-invalid":                        ErrTokenInvalid,
+	"error.security.client-token-missing":                         ErrTokenInvalid,
+	"error.security.account-token-missing":                        ErrTokenInvalid,
+	"error.service.marketdata.instrument.epic.unavailable":        ErrEpicUnavailable,
+	"error.confirms.deal-not-found":                               ErrDealNotFound,
+	"error.security.account-not-found":                            ErrAccountNotFound,
+}
+
+// APIError - Error returned by the IG REST API for a non-200 response
+type APIError struct {
+	StatusCode int           // HTTP status code, e.g. 403
+	ErrorCode  string        // IG error code, e.g. "error.public-api.exceeded-api-key-allowance"
+	Method     string        // HTTP method, e.g. "GET"
+	Endpoint   string        // Request path, e.g. "/gateway/deal/positions"
+	Version    int           // Endpoint version sent in the VERSION header
+	Body       []byte        // Raw response body
+	RetryAfter time.Duration // Parsed Retry-After response header, zero if not given
+}
+
+// Error - Implements the error interface
+func (e *APIError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("igmarkets: %s %s (version %d) failed with HTTP status %d: %s",
+			e.Method, e.Endpoint, e.Version, e.StatusCode, e.ErrorCode)
+	}
+	return fmt.Sprintf("igmarkets: %s %s (version %d) failed with HTTP status %d (body=%q)",
+		e.Method, e.Endpoint, e.Version, e.StatusCode, e.Body)
+}
+
+// Unwrap - Returns the sentinel error matching the IG error code (if any)
+func (e *APIError) Unwrap() error {
+	if sentinel, found := errorCodeSentinels[e.ErrorCode]; found {
+		return sentinel
+	}
+	if strings.Contains(e.ErrorCode, "market-closed") || strings.Contains(e.ErrorCode, "market.closed") {
+		return ErrMarketClosed
+	}
+	return nil
+}
+
+// DealRejectedError - Returned by the Execute methods for a confirmation with dealStatus REJECTED
+type DealRejectedError struct {
+	DealReference string
+	Reason        DealReason // IG's reason code, e.g. DealReasonMarketClosedWithEdits
+	Confirmation  *OTCDealConfirmation
+}
+
+// Error - Implements the error interface
+func (e *DealRejectedError) Error() string {
+	return fmt.Sprintf("igmarkets: deal %q rejected: %s", e.DealReference, e.Reason)
+}
+
+// Unwrap - Returns ErrDealRejected
+func (e *DealRejectedError) Unwrap() error {
+	return ErrDealRejected
+}
+
+// newAPIError - Build APIError from a non-200 response and decode IG's errorCode from the body
+func newAPIError(method, endpoint string, version int, resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Endpoint:   endpoint,
+		Version:    version,
+		Body:       body,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var igError struct {
+		ErrorCode string `json:"errorCode"`
+	}
+	if err := json.Unmarshal(body, &igError); err == nil {
+		apiErr.ErrorCode = igError.ErrorCode
+	}
+
+	return apiErr
+}
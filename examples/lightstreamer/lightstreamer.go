@@ -7,38 +7,33 @@ import (
 	"github.com/sklinkert/igmarkets"
 )
 
-var conf struct {
-	igAPIURL     string
-	igIdentifier string
-	igAPIKey     string
-	igPassword   string
-	igAccountID  string
-	epics        []string
-}
-
 func main() {
+	var epics []string
 	var e = env.New()
-	e.OptionalList("EPICS", &conf.epics, ",", []string{"CS.D.EURUSD.MINI.IP", "CS.D.BITCOIN.CFD.IP"}, "Instruments to subscribe")
-	e.OptionalString("IG_API_URL", &conf.igAPIURL, igmarkets.DemoAPIURL, "IG API URL")
-	e.OptionalString("IG_IDENTIFIER", &conf.igIdentifier, "", "IG Identifier")
-	e.OptionalString("IG_API_KEY", &conf.igAPIKey, "", "IG API key")
-	e.OptionalString("IG_PASSWORD", &conf.igPassword, "", "IG password")
-	e.OptionalString("IG_ACCOUNT", &conf.igAccountID, "", "IG account ID")
+	e.OptionalList("EPICS", &epics, ",", []string{"CS.D.EURUSD.MINI.IP", "CS.D.BITCOIN.CFD.IP"}, "Instruments to subscribe")
 	if err := e.Load(); err != nil {
 		log.WithError(err).Fatal("env loading failed")
 	}
 
+	config, err := igmarkets.LoadConfigFromEnv()
+	if err != nil {
+		log.WithError(err).Fatal("config loading failed")
+	}
+
 	var ctx = context.Background()
 
 	for {
-		igHandle := igmarkets.New(conf.igAPIURL, conf.igAPIKey, conf.igAccountID, conf.igIdentifier, conf.igPassword)
+		igHandle, err := igmarkets.NewFromConfig(*config)
+		if err != nil {
+			log.WithError(err).Fatal("invalid config")
+		}
 		if err := igHandle.Login(ctx); err != nil {
 			log.WithError(err).Error("new fialed")
 			return
 		}
 
 		tickChan := make(chan igmarkets.LightStreamerTick)
-		err := igHandle.OpenLightStreamerSubscription(ctx, conf.epics, tickChan)
+		err = igHandle.OpenLightStreamerSubscription(ctx, epics, tickChan)
 		if err != nil {
 			log.WithError(err).Error("open stream fialed")
 		}
@@ -0,0 +1,207 @@
+package igmarkets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConfirmPolicy - How the Execute methods wait for the deal confirmation
+type ConfirmPolicy struct {
+	Timeout        time.Duration // Give up waiting after this duration
+	InitialBackoff time.Duration // Delay before polling GetDealConfirmation() the first time
+	MaxBackoff     time.Duration // Upper bound for the exponential backoff between polls
+}
+
+// DefaultConfirmPolicy - Poll for up to 30 seconds, starting after 100ms
+func DefaultConfirmPolicy() ConfirmPolicy {
+	return ConfirmPolicy{
+		Timeout:        30 * time.Second,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+	}
+}
+
+// WithConfirmPolicy - Use the given policy instead of DefaultConfirmPolicy() in the Execute methods
+func WithConfirmPolicy(policy ConfirmPolicy) Option {
+	return func(ig *IGMarkets) error {
+		if policy.Timeout <= 0 || policy.InitialBackoff <= 0 {
+			return fmt.Errorf("igmarkets: confirm policy requires a positive timeout and initial backoff")
+		}
+		ig.confirmPolicy = policy
+		return nil
+	}
+}
+
+// ExecuteOTCOrder - Place an OTC order and wait for its confirmation. A deal reference is generated if the
+// order has none, so the order can be retried safely. A REJECTED deal returns the confirmation and a *DealRejectedError.
+func (ig *IGMarkets) ExecuteOTCOrder(ctx context.Context, order OTCOrderRequest) (*OTCDealConfirmation, error) {
+	if order.DealReference == "" {
+		order.DealReference = newDealReference()
+	}
+	dealRef, err := ig.PlaceOTCOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	return ig.WaitForDealConfirmation(ctx, dealRef.DealReference)
+}
+
+// ExecuteOTCWorkingOrder - Place an OTC working order and wait for its confirmation, see ExecuteOTCOrder()
+func (ig *IGMarkets) ExecuteOTCWorkingOrder(ctx context.Context, order OTCWorkingOrderRequest) (*OTCDealConfirmation, error) {
+	if order.DealReference == "" {
+		order.DealReference = newDealReference()
+	}
+	dealRef, err := ig.PlaceOTCWorkingOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	return ig.WaitForDealConfirmation(ctx, dealRef.DealReference)
+}
+
+// ExecuteUpdateOTCOrder - Update an OTC position and wait for its confirmation, see ExecuteOTCOrder()
+func (ig *IGMarkets) ExecuteUpdateOTCOrder(ctx context.Context, dealID string, order OTCUpdateOrderRequest) (*OTCDealConfirmation, error) {
+	dealRef, err := ig.UpdateOTCOrder(ctx, dealID, order)
+	if err != nil {
+		return nil, err
+	}
+	return ig.WaitForDealConfirmation(ctx, dealRef.DealReference)
+}
+
+// ExecuteUpdateOTCWorkingOrder - Update an OTC working order and wait for its confirmation, see ExecuteOTCOrder()
+func (ig *IGMarkets) ExecuteUpdateOTCWorkingOrder(ctx context.Context, dealID string, order OTCUpdateWorkingOrderRequest) (*OTCDealConfirmation, error) {
+	dealRef, err := ig.UpdateOTCWorkingOrder(ctx, dealID, order)
+	if err != nil {
+		return nil, err
+	}
+	return ig.WaitForDealConfirmation(ctx, dealRef.DealReference)
+}
+
+// ExecuteCloseOTCPosition - Close an OTC position and wait for its confirmation, see ExecuteOTCOrder()
+func (ig *IGMarkets) ExecuteCloseOTCPosition(ctx context.Context, close OTCPositionCloseRequest) (*OTCDealConfirmation, error) {
+	dealRef, err := ig.CloseOTCPosition(ctx, close)
+	if err != nil {
+		return nil, err
+	}
+	return ig.WaitForDealConfirmation(ctx, dealRef.DealReference)
+}
+
+// WaitForDealConfirmation - Poll GetDealConfirmation() with exponential backoff until IG knows the deal reference,
+// or return the confirmation as soon as it is streamed by OpenLightStreamerTradeSubscription().
+// A REJECTED deal returns the confirmation and a *DealRejectedError.
+func (ig *IGMarkets) WaitForDealConfirmation(ctx context.Context, dealRef string) (*OTCDealConfirmation, error) {
+	policy := ig.confirmPolicy
+	if policy.Timeout <= 0 {
+		policy = DefaultConfirmPolicy()
+	}
+	ctx, cancel := context.WithTimeout(ctx, policy.Timeout)
+	defer cancel()
+
+	streamed, stopWaiting := ig.confirms.wait(dealRef)
+	defer stopWaiting()
+
+	delay := policy.InitialBackoff
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case confirm := <-streamed:
+			timer.Stop()
+			return checkDealConfirmation(dealRef, &confirm)
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("igmarkets: no confirmation for deal reference %q: %w", dealRef, ctx.Err())
+		case <-timer.C:
+		}
+
+		confirm, err := ig.GetDealConfirmation(ctx, dealRef)
+		if err == nil {
+			return checkDealConfirmation(dealRef, confirm)
+		}
+		if !errors.Is(err, ErrDealNotFound) {
+			return nil, err
+		}
+
+		delay *= 2
+		if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+}
+
+// checkDealConfirmation - Map a REJECTED deal status to DealRejectedError
+func checkDealConfirmation(dealRef string, confirm *OTCDealConfirmation) (*OTCDealConfirmation, error) {
+	if confirm.DealStatus == DealStatusRejected {
+		return confirm, &DealRejectedError{DealReference: dealRef, Reason: confirm.Reason, Confirmation: confirm}
+	}
+	return confirm, nil
+}
+
+// newDealReference - Random reference accepted by IG (up to 30 characters of [A-Za-z0-9_-])
+func newDealReference() string {
+	var random [12]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return fmt.Sprintf("igm%d", time.Now().UnixNano())
+	}
+	return "igm" + hex.EncodeToString(random[:])
+}
+
+// maxRecentConfirms - Streamed confirmations kept for Execute calls that start waiting after the stream delivered
+const maxRecentConfirms = 100
+
+// confirmWaiters - Hands streamed confirmations to WaitForDealConfirmation()
+type confirmWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]chan OTCDealConfirmation // deal reference -> waiter
+	recent  map[string]OTCDealConfirmation
+	order   []string // Deal references of recent, oldest first
+}
+
+// wait - Channel receiving the streamed confirmation of the deal reference; call stop when done
+func (c *confirmWaiters) wait(dealRef string) (confirm <-chan OTCDealConfirmation, stop func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan OTCDealConfirmation, 1)
+	if recent, found := c.recent[dealRef]; found {
+		ch <- recent
+	}
+	if c.waiters == nil {
+		c.waiters = make(map[string]chan OTCDealConfirmation)
+	}
+	c.waiters[dealRef] = ch
+	return ch, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.waiters[dealRef] == ch {
+			delete(c.waiters, dealRef)
+		}
+	}
+}
+
+// deliver - Pass a streamed confirmation to its waiter and remember it
+func (c *confirmWaiters) deliver(confirm OTCDealConfirmation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ch, found := c.waiters[confirm.DealReference]; found {
+		select {
+		case ch <- confirm:
+		default:
+		}
+	}
+
+	if c.recent == nil {
+		c.recent = make(map[string]OTCDealConfirmation)
+	}
+	if _, found := c.recent[confirm.DealReference]; !found {
+		c.order = append(c.order, confirm.DealReference)
+	}
+	c.recent[confirm.DealReference] = confirm
+	if len(c.order) > maxRecentConfirms {
+		delete(c.recent, c.order[0])
+		c.order = c.order[1:]
+	}
+}
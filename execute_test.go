@@ -0,0 +1,88 @@
+package igmarkets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/AMekss/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecuteOTCOrder(t *testing.T) {
+	var mu sync.Mutex
+	var dealReference string
+	confirmRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/gateway/deal/positions/otc":
+			var order OTCOrderRequest
+			_ = json.NewDecoder(r.Body).Decode(&order)
+			dealReference = order.DealReference
+			_, _ = w.Write([]byte(`{"dealReference":"` + dealReference + `"}`))
+		case "/gateway/deal/confirms/" + dealReference:
+			// IG needs a moment before the confirmation is available
+			confirmRequests++
+			if confirmRequests < 3 {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errorCode":"error.confirms.deal-not-found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"dealReference":"` + dealReference + `","dealStatus":"REJECTED","reason":"MARKET_CLOSED_WITH_EDITS"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errorCode":"error.confirms.deal-not-found"}`))
+		}
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL),
+		WithConfirmPolicy(ConfirmPolicy{Timeout: time.Second, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}))
+	assert.NoError(t, err)
+
+	confirm, err := igm.ExecuteOTCOrder(context.Background(), OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: DecimalFromFloat(1)})
+	assert.True(t, errors.Is(err, ErrDealRejected))
+	var rejected *DealRejectedError
+	assert.True(t, errors.As(err, &rejected))
+	assert.EqualStrings(t, "MARKET_CLOSED_WITH_EDITS", string(rejected.Reason))
+	assert.EqualStrings(t, "REJECTED", string(confirm.DealStatus))
+
+	mu.Lock()
+	assert.True(t, dealReference != "")
+	assert.EqualStrings(t, dealReference, rejected.DealReference)
+	assert.EqualInt(t, 3, confirmRequests)
+	mu.Unlock()
+
+	// Give up after the timeout
+	igm, err = NewWithOptions(WithBaseURL(server.URL),
+		WithConfirmPolicy(ConfirmPolicy{Timeout: 20 * time.Millisecond, InitialBackoff: time.Millisecond}))
+	assert.NoError(t, err)
+	_, err = igm.WaitForDealConfirmation(context.Background(), "unknown")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestExecuteWithStreamedConfirmation(t *testing.T) {
+	igm, err := NewWithOptions(
+		WithConfirmPolicy(ConfirmPolicy{Timeout: time.Second, InitialBackoff: time.Hour}))
+	assert.NoError(t, err)
+
+	// Confirmations streamed before waiting are kept
+	igm.confirms.deliver(OTCDealConfirmation{DealReference: "REF1", DealStatus: "ACCEPTED", DealID: "DIAAAA1"})
+	confirm, err := igm.WaitForDealConfirmation(context.Background(), "REF1")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "DIAAAA1", confirm.DealID)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		igm.confirms.deliver(OTCDealConfirmation{DealReference: "REF2", DealStatus: "REJECTED", Reason: "INSUFFICIENT_FUNDS"})
+	}()
+	_, err = igm.WaitForDealConfirmation(context.Background(), "REF2")
+	var rejected *DealRejectedError
+	assert.True(t, errors.As(err, &rejected))
+	assert.EqualStrings(t, "INSUFFICIENT_FUNDS", string(rejected.Reason))
+}
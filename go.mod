@@ -1,9 +1,18 @@
 module github.com/sklinkert/igmarkets
 
-go 1.16
+go 1.21
 
 require (
 	github.com/AMekss/assert v0.0.0-20190715092210-758496b7ede5
 	github.com/lfritz/env v1.0.0
 	github.com/sirupsen/logrus v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/rogpeppe/go-internal v1.10.0 // indirect
+	github.com/stretchr/testify v1.9.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
@@ -3,11 +3,12 @@ package igmarkets
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"reflect"
 	"sync"
 	"time"
 )
@@ -26,10 +27,37 @@ type IGMarkets struct {
 	AccountID             string
 	Identifier            string
 	Password              string
+	EncryptPassword       bool // Send password RSA encrypted with the key from GetEncryptionKey()
 	TimeZone              *time.Location
 	TimeZoneLightStreamer *time.Location
 	OAuthToken            OAuthToken
+	AuthMode              AuthMode     // OAuth (default) or CST/X-SECURITY-TOKEN session tokens
+	CSTToken              string       // Client session token from LoginVersion2()
+	XSTToken              string       // X-SECURITY-TOKEN from LoginVersion2()
+	RetryPolicy           RetryPolicy  // Zero value disables retries, see DefaultRetryPolicy()
+	RateLimiter           *RateLimiter // nil disables client-side rate limiting
 	httpClient            *http.Client
+	timeout               time.Duration
+	userAgent             string
+	logger                Logger
+	tokenExpiry           time.Time // When OAuthToken expires
+	tokenLifetime         time.Duration
+	keepSession           bool
+	sessionEvents         chan SessionEvent
+	cancelSessionKeeper   context.CancelFunc
+	sessionCreated        time.Time // Login time of CSTToken/XSTToken
+	sessionLastUsed       time.Time // Last successful request with CSTToken/XSTToken
+	reauthMutex           sync.Mutex
+	sessionStore          SessionStore
+	middlewares           []Middleware
+	observers             []Observer
+	streamsEnded          int // Streams of OpenLightStreamerSubscription() that ended, trade subscriptions are not counted
+	strictDecoding        bool
+	schemaDriftHandler    SchemaDriftHandler
+	dealer                Dealer // Serves the dealing endpoints if set, see WithDealer()
+	confirmPolicy         ConfirmPolicy
+	confirms              confirmWaiters  // Confirmations of OpenLightStreamerTradeSubscription()
+	orderValidation       *orderValidator // Pre-flight checks of WithOrderValidation()
 	sync.RWMutex
 }
 
@@ -39,75 +67,200 @@ func New(apiURL, apiKey, accountID, identifier, password string) *IGMarkets {
 		log.Panic("Invalid endpoint URL", apiURL)
 	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: 5,
-		},
+	ig, err := NewWithOptions(
+		WithBaseURL(apiURL),
+		WithCredentials(apiKey, identifier, password),
+		WithAccountID(accountID),
+	)
+	if err != nil {
+		log.Panic(err)
 	}
 
-	return &IGMarkets{
-		APIURL:     apiURL,
-		APIKey:     apiKey,
-		AccountID:  accountID,
-		Identifier: identifier,
-		Password:   password,
-		httpClient: httpClient,
-	}
+	return ig
 }
 
-func (ig *IGMarkets) doRequestWithoutOAuth(ctx context.Context, req *http.Request, endpointVersion int, igResponse interface{}) (interface{}, error) {
-	object, _, err := ig.doRequestWithResponseHeaders(ctx, req, endpointVersion, igResponse, false)
-	return object, err
+// do - Send authenticated request and decode the JSON response into T
+func do[T any](ctx context.Context, ig *IGMarkets, req *http.Request, endpointVersion int) (*T, error) {
+	igResponse, _, err := doWithResponseHeaders[T](ctx, ig, req, endpointVersion, true)
+	return igResponse, err
 }
 
-func (ig *IGMarkets) doRequest(ctx context.Context, req *http.Request, endpointVersion int, igResponse interface{}) (interface{}, error) {
-	object, _, err := ig.doRequestWithResponseHeaders(ctx, req, endpointVersion, igResponse, true)
-	return object, err
+// doWithoutOAuth - Send request without access token (e.g. login) and decode the JSON response into T
+func doWithoutOAuth[T any](ctx context.Context, ig *IGMarkets, req *http.Request, endpointVersion int) (*T, error) {
+	igResponse, _, err := doWithResponseHeaders[T](ctx, ig, req, endpointVersion, false)
+	return igResponse, err
 }
 
-func (ig *IGMarkets) doRequestWithResponseHeaders(ctx context.Context, req *http.Request, endpointVersion int, igResponse interface{}, oAuth bool) (interface{}, http.Header, error) {
-	ig.RLock()
-	if ig.OAuthToken.AccessToken != "" && oAuth {
-		req.Header.Set("Authorization", "Bearer "+ig.OAuthToken.AccessToken)
+// doWithResponseHeaders - Send request and stream the JSON response into T
+func doWithResponseHeaders[T any](ctx context.Context, ig *IGMarkets, req *http.Request, endpointVersion int, oAuth bool) (*T, http.Header, error) {
+	resp, err := ig.send(ctx, req, endpointVersion, oAuth)
+	if err != nil {
+		return nil, nil, err
 	}
-	req.Header.Set("X-IG-API-KEY", ig.APIKey)
-	req.Header.Set("IG-ACCOUNT-ID", ig.AccountID)
-	ig.RUnlock()
+	defer ig.closeBody(resp.Body)
+
+	var igResponse T
+	if ig.strictDecoding {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("igmarkets: unable to read response body: %w", err)
+		}
+		decodeReq := &Request{Method: req.Method, Path: req.URL.Path, Version: endpointVersion}
+		if err := ig.decodeStrict(decodeReq, body, &igResponse); err != nil {
+			return nil, nil, fmt.Errorf("igmarkets: unable to unmarshal JSON response: %v", err)
+		}
+		return &igResponse, resp.Header, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&igResponse); err != nil {
+		return nil, nil, fmt.Errorf("igmarkets: unable to unmarshal JSON response: %v", err)
+	}
+
+	return &igResponse, resp.Header, nil
+}
+
+// doWithoutResponse - Send authenticated request and discard the response body
+func (ig *IGMarkets) doWithoutResponse(ctx context.Context, req *http.Request, endpointVersion int) error {
+	resp, err := ig.send(ctx, req, endpointVersion, true)
+	if err != nil {
+		return err
+	}
+	defer ig.closeBody(resp.Body)
+
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return fmt.Errorf("igmarkets: unable to read response body: %w", err)
+	}
+	return nil
+}
+
+// send - Send request with retries and re-authentication. The caller must close the body of the returned response.
+func (ig *IGMarkets) send(ctx context.Context, req *http.Request, endpointVersion int, oAuth bool) (*Response, error) {
+	if oAuth && ig.AuthMode == AuthModeSessionTokens {
+		if err := ig.ensureSessionTokens(ctx); err != nil {
+			return nil, err
+		}
+	}
+	accessToken := ig.setAuthHeaders(req, oAuth)
 
 	req.Header.Set("Accept", "application/json; charset=UTF-8")
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
 	req.Header.Set("VERSION", fmt.Sprintf("%d", endpointVersion))
+	if ig.userAgent != "" {
+		req.Header.Set("User-Agent", ig.userAgent)
+	}
 
 	req = req.WithContext(ctx)
-	resp, err := ig.httpClient.Do(req)
-	if err != nil {
-		return igResponse, nil, fmt.Errorf("igmarkets: unable to get markets data: %v", err)
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			fmt.Printf("igmarkets.doRequest:  resp.Body.Close() failed: %v", err)
+
+	var resp *Response
+	var err error
+	var reauthenticated bool
+	for attempt := 1; ; attempt++ {
+		resp, err = ig.doLimitedAttempt(ctx, req, endpointVersion)
+		if err == nil {
+			break
 		}
-	}()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return igResponse, nil, fmt.Errorf("igmarkets: unable to get body of transactions markets data: %v", err)
+		if oAuth && !reauthenticated && errors.Is(err, ErrTokenInvalid) && ig.reauthenticationEnabled(ctx) {
+			// Token expired in the meantime: renew it and send the request once more
+			reauthenticated = true
+			ig.log(logLevelInfo, "token rejected, renewing session", "endpoint", req.URL.Path, "version", endpointVersion)
+			if err := ig.reauthenticate(ctx, accessToken); err != nil {
+				return nil, err
+			}
+			accessToken = ig.setAuthHeaders(req, oAuth)
+		} else {
+			delay, retry := ig.RetryPolicy.retryDelay(ctx, req, attempt, err)
+			if !retry {
+				return nil, err
+			}
+			ig.log(logLevelDebug, "retrying request", "method", req.Method, "endpoint", req.URL.Path,
+				"version", endpointVersion, "attempt", attempt, "delay", delay, "error", err)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("igmarkets: unable to rewind request body: %v", err)
+			}
+		}
+	}
+
+	if oAuth && ig.AuthMode == AuthModeSessionTokens {
+		ig.updateSessionTokens(resp.Header)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return igResponse, nil, fmt.Errorf("igmarkets: unexpected HTTP status code: %d (body=%q)", resp.StatusCode, body)
+
+	return resp, nil
+}
+
+func (ig *IGMarkets) closeBody(body io.Closer) {
+	if err := body.Close(); err != nil {
+		ig.log(logLevelWarn, "closing response body failed", "error", err)
 	}
+}
 
-	if igResponse != nil {
-		objType := reflect.TypeOf(igResponse)
-		obj := reflect.New(objType).Interface()
-		if obj != nil {
-			if err := json.Unmarshal(body, &obj); err != nil {
-				return obj, nil, fmt.Errorf("igmarkets: unable to unmarshal JSON response: %v", err)
-			}
+// setAuthHeaders - Set API key, account and token headers and return the token used.
+// Depending on AuthMode the OAuth access token or the CST/X-SECURITY-TOKEN pair is sent.
+func (ig *IGMarkets) setAuthHeaders(req *http.Request, oAuth bool) string {
+	ig.RLock()
+	defer ig.RUnlock()
 
-			return obj, resp.Header, nil
+	var accessToken string
+	switch {
+	case !oAuth:
+	case ig.AuthMode == AuthModeSessionTokens && ig.CSTToken != "":
+		accessToken = ig.CSTToken
+		req.Header.Set("CST", ig.CSTToken)
+		req.Header.Set("X-SECURITY-TOKEN", ig.XSTToken)
+	case ig.AuthMode == AuthModeOAuth && ig.OAuthToken.AccessToken != "":
+		accessToken = ig.OAuthToken.AccessToken
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("X-IG-API-KEY", ig.APIKey)
+	req.Header.Set("IG-ACCOUNT-ID", ig.AccountID)
+	return accessToken
+}
+
+// currentToken - Token setAuthHeaders() would send; caller must hold the lock
+func (ig *IGMarkets) currentToken() string {
+	if ig.AuthMode == AuthModeSessionTokens {
+		return ig.CSTToken
+	}
+	return ig.OAuthToken.AccessToken
+}
+
+// doLimitedAttempt - Send the request through the middlewares once the client-side rate limiter allows it
+func (ig *IGMarkets) doLimitedAttempt(ctx context.Context, req *http.Request, endpointVersion int) (*Response, error) {
+	var class RequestClass
+	if ig.RateLimiter != nil {
+		var cost float64
+		class, cost = classifyRequest(req)
+		if err := ig.RateLimiter.wait(ctx, class, cost); err != nil {
+			return nil, err
 		}
 	}
 
-	return igResponse, resp.Header, nil
+	resp, err := ig.handler()(ctx, &Request{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Version:     endpointVersion,
+		HTTPRequest: req,
+	})
+	if ig.RateLimiter != nil && (errors.Is(err, ErrRateLimited) || errors.Is(err, ErrHistoricalDataAllowanceExceeded)) {
+		ig.RateLimiter.exhaust(class)
+	}
+	if err != nil {
+		if resp != nil && resp.Body != nil {
+			ig.closeBody(resp.Body)
+		}
+		return nil, err
+	}
+	if resp == nil {
+		resp = &Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	}
+	if resp.Body == nil {
+		// Middleware answered without calling the next handler
+		resp.Body = http.NoBody
+	}
+	return resp, nil
 }
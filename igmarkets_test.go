@@ -1,11 +1,274 @@
 package igmarkets
 
 import (
+	"context"
+	"errors"
 	"github.com/AMekss/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
 	igm := New(DemoAPIURL, "", "", "", "")
 	assert.False(t, igm == nil)
 }
+
+func TestNewWithOptions(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte(`{"trailingStopsEnabled":true}`))
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL+"/"), WithUserAgent("bot/1.0"), WithTimeout(time.Second))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, server.URL, igm.APIURL)
+
+	preferences, err := igm.GetAccountPreferences(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, preferences.TrailingStopsEnabled)
+	assert.EqualStrings(t, "bot/1.0", userAgent)
+
+	_, err = NewWithOptions(WithBaseURL("demo-api.ig.com"))
+	assert.True(t, err != nil)
+}
+
+func TestAPIError(t *testing.T) {
+	body := []byte(`{"errorCode":"error.public-api.exceeded-api-key-allowance"}`)
+	resp := &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": []string{"5"}}}
+	err := error(newAPIError("GET", "/gateway/deal/positions", 2, resp, body))
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.EqualInt(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.EqualStrings(t, "error.public-api.exceeded-api-key-allowance", apiErr.ErrorCode)
+	assert.True(t, apiErr.RetryAfter == 5*time.Second)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.False(t, errors.Is(err, ErrTokenInvalid))
+
+	resp = &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}}
+	err = newAPIError("POST", "/gateway/deal/session", 3, resp, []byte("not json"))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.EqualStrings(t, "", apiErr.ErrorCode)
+	assert.False(t, errors.Is(err, ErrInvalidCredentials))
+}
+
+func TestTypedResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gateway/deal/watchlists":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/gateway/deal/clientsentiment/FOO":
+			_, _ = w.Write([]byte(`{"longPositionPercentage":60.5`))
+		default:
+			_, _ = w.Write([]byte(`{"longPositionPercentage":60.5}`))
+		}
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL))
+	assert.NoError(t, err)
+
+	sentiment, err := igm.GetClientSentiment(context.Background(), "BAR")
+	assert.NoError(t, err)
+	assert.True(t, sentiment.LongPositionPercentage == 60.5)
+
+	// Truncated JSON and API errors must not return partially decoded or nil-dereferenced results
+	sentiment, err = igm.GetClientSentiment(context.Background(), "FOO")
+	assert.True(t, err != nil)
+	assert.True(t, sentiment == nil)
+
+	watchlists, err := igm.GetAllWatchlists(context.Background())
+	assert.True(t, err != nil)
+	assert.True(t, watchlists == nil)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"dealReference":"REF"}`))
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	assert.NoError(t, err)
+
+	// Orders without deal reference must not be retried
+	_, err = igm.PlaceOTCOrder(context.Background(), OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP"})
+	assert.True(t, err != nil)
+	assert.EqualInt(t, 1, calls)
+
+	calls = 0
+	dealRef, err := igm.PlaceOTCOrder(context.Background(), OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", DealReference: "REF"})
+	assert.NoError(t, err)
+	assert.EqualInt(t, 2, calls)
+	assert.EqualStrings(t, "REF", dealRef.DealReference)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{TradingPerMinute: 2, NonTradingPerMinute: 60, Policy: RateLimitFailFast})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("POST", "/gateway/deal/positions/otc", nil)
+	class, cost := classifyRequest(req)
+	assert.True(t, class == RequestClassTrading)
+
+	ctx := context.Background()
+	assert.NoError(t, limiter.wait(ctx, class, cost))
+	assert.NoError(t, limiter.wait(ctx, class, cost))
+	assert.EqualErrors(t, ErrClientRateLimited, limiter.wait(ctx, class, cost))
+
+	// Half a minute later one token has been refilled
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, limiter.wait(ctx, class, cost))
+
+	req = httptest.NewRequest("GET", "/gateway/deal/prices/CS.D.EURUSD.CFD.IP?resolution=DAY&max=50", nil)
+	class, cost = classifyRequest(req)
+	assert.True(t, class == RequestClassHistoricalPrices)
+	assert.EqualFloat64(t, 50, cost)
+
+	// Historical prices bucket is disabled
+	assert.EqualInt(t, 2, len(limiter.Levels()))
+}
+
+func TestKeepSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gateway/deal/session":
+			_, _ = w.Write([]byte(`{"oauthToken":{"access_token":"TOKEN1","refresh_token":"REFRESH1","expires_in":"60"}}`))
+		case "/gateway/deal/session/refresh-token":
+			_, _ = w.Write([]byte(`{"access_token":"TOKEN2","refresh_token":"REFRESH2","expires_in":"60"}`))
+		default:
+			if r.Header.Get("Authorization") != "Bearer TOKEN2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"errorCode":"error.security.oauth-token-invalid"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"trailingStopsEnabled":true}`))
+		}
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := igm.KeepSession(ctx)
+	assert.NoError(t, err)
+	assert.True(t, (<-events).State == SessionStateLoggedIn)
+
+	// Token is rejected, refreshed and the request is sent again
+	_, err = igm.GetAccountPreferences(ctx)
+	assert.NoError(t, err)
+	assert.True(t, (<-events).State == SessionStateRefreshed)
+	assert.EqualStrings(t, "TOKEN2", igm.OAuthToken.AccessToken)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestSessionTokenAuthMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gateway/deal/session" {
+			w.Header().Set("CST", "CST1")
+			w.Header().Set("X-SECURITY-TOKEN", "XST1")
+			_, _ = w.Write([]byte(`{"currentAccountId":"ABC","timezoneOffset":1}`))
+			return
+		}
+		if r.Header.Get("CST") != "CST1" || r.Header.Get("X-SECURITY-TOKEN") != "XST1" || r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errorCode":"error.security.client-token-invalid"}`))
+			return
+		}
+		w.Header().Set("X-SECURITY-TOKEN", "XST2")
+		_, _ = w.Write([]byte(`{"trailingStopsEnabled":true}`))
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithAuthMode(AuthModeSessionTokens))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(context.Background()))
+	assert.EqualStrings(t, "CST1", igm.CSTToken)
+
+	_, err = igm.GetAccountPreferences(context.Background())
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "XST2", igm.XSTToken)
+
+	// Tokens expire after 6 hours without requests
+	igm.sessionLastUsed = time.Now().Add(-7 * time.Hour)
+	_, err = igm.GetAccountPreferences(context.Background())
+	assert.True(t, errors.Is(err, ErrTokenInvalid))
+}
+
+func TestKeepSessionTokensUntilIdle(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gateway/deal/session" {
+			mu.Lock()
+			logins++
+			mu.Unlock()
+			w.Header().Set("CST", "CST1")
+			w.Header().Set("X-SECURITY-TOKEN", "XST1")
+			_, _ = w.Write([]byte(`{"currentAccountId":"ABC"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"trailingStopsEnabled":true}`))
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithAuthMode(AuthModeSessionTokens))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, igm.Login(ctx))
+
+	// The renewal is due shortly, but a request extends the session before
+	igm.Lock()
+	igm.sessionLastUsed = time.Now().Add(-sessionTokenIdleTimeout + sessionTokenRenewalMargin + 100*time.Millisecond)
+	igm.Unlock()
+	_, err = igm.KeepSession(ctx)
+	assert.NoError(t, err)
+	_, err = igm.GetAccountPreferences(ctx)
+	assert.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.EqualInt(t, 1, logins)
+}
+
+func TestSwitchAccountAndLogout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+			_, _ = w.Write([]byte(`{"dealingEnabled":true}`))
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithAccountID("CFD"))
+	assert.NoError(t, err)
+	igm.OAuthToken.AccessToken = "TOKEN"
+
+	response, err := igm.SwitchAccount(context.Background(), "SPREADBET", false)
+	assert.NoError(t, err)
+	assert.True(t, response.DealingEnabled)
+	assert.EqualStrings(t, "SPREADBET", igm.AccountID)
+
+	assert.NoError(t, igm.Logout(context.Background()))
+	assert.EqualStrings(t, "", igm.OAuthToken.AccessToken)
+}
@@ -0,0 +1,310 @@
+package igtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sklinkert/igmarkets"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// redacted - Replaces credentials, tokens and account IDs in cassettes
+const redacted = "REDACTED"
+
+// sensitiveHeaders - Request and response headers scrubbed before recording
+var sensitiveHeaders = []string{"Authorization", "CST", "X-SECURITY-TOKEN", "X-IG-API-KEY", "IG-ACCOUNT-ID"}
+
+// sensitiveFields - JSON fields scrubbed in request and response bodies, compared case-insensitively
+var sensitiveFields = map[string]bool{
+	"identifier": true, "password": true, "access_token": true, "refresh_token": true,
+	"accountid": true, "currentaccountid": true, "clientid": true, "accountname": true, "accountalias": true,
+}
+
+// Interaction - Recorded request/response pair of a cassette
+type Interaction struct {
+	Method         string          `json:"method"` // Including the _method override
+	Path           string          `json:"path"`
+	Query          string          `json:"query,omitempty"`
+	Version        string          `json:"version"`
+	RequestHeader  http.Header     `json:"requestHeader,omitempty"`
+	RequestBody    json.RawMessage `json:"requestBody,omitempty"`
+	StatusCode     int             `json:"statusCode"`
+	ResponseHeader http.Header     `json:"responseHeader,omitempty"`
+	ResponseBody   json.RawMessage `json:"responseBody,omitempty"`
+}
+
+// Cassette - Interactions stored in a fixture file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder - http.RoundTripper sending requests to IG and writing the sanitized interactions to a cassette file
+type Recorder struct {
+	path     string
+	next     http.RoundTripper
+	secrets  []string
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder - Record to the cassette file at path, an existing file is overwritten.
+// next sends the requests, http.DefaultTransport is used if nil.
+func NewRecorder(path string, next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{path: path, next: next}
+}
+
+// Scrub - Replace the given values, e.g. account IDs or the identifier, wherever they appear in the cassette
+func (r *Recorder) Scrub(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+}
+
+// Option - Send all REST requests of a client created by igmarkets.NewWithOptions() through the recorder
+func (r *Recorder) Option() igmarkets.Option {
+	return igmarkets.WithHTTPClient(&http.Client{Transport: r})
+}
+
+// RoundTrip - Implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		if requestBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("igtest: unable to read request body: %v", err)
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("igtest: unable to read response body: %v", err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interaction := Interaction{
+		Method:         requestMethod(req),
+		Path:           req.URL.Path,
+		Query:          req.URL.RawQuery,
+		Version:        req.Header.Get("VERSION"),
+		RequestHeader:  r.scrubHeader(req.Header),
+		RequestBody:    r.scrubBody(requestBody),
+		StatusCode:     resp.StatusCode,
+		ResponseHeader: r.scrubHeader(resp.Header),
+		ResponseBody:   r.scrubBody(responseBody),
+	}
+	interaction.Path = r.scrubString(interaction.Path)
+	interaction.Query = r.scrubString(interaction.Query)
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save - Write the cassette; caller must hold the lock
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(&r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("igtest: unable to encode cassette: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("igtest: unable to create cassette directory: %v", err)
+	}
+	if err := ioutil.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("igtest: unable to write cassette: %v", err)
+	}
+	return nil
+}
+
+func (r *Recorder) scrubHeader(header http.Header) http.Header {
+	scrubbed := http.Header{}
+	for key, values := range header {
+		if key == "Set-Cookie" || key == "Date" {
+			continue
+		}
+		for _, value := range values {
+			scrubbed.Add(key, r.scrubString(value))
+		}
+	}
+	for _, key := range sensitiveHeaders {
+		if scrubbed.Get(key) != "" {
+			scrubbed.Set(key, redacted)
+		}
+	}
+	return scrubbed
+}
+
+// scrubBody - Replace sensitive fields of JSON bodies. Other bodies are stored as JSON string.
+func (r *Recorder) scrubBody(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	// Numbers are kept as recorded instead of going through float64
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		quoted, _ := json.Marshal(r.scrubString(string(body)))
+		return quoted
+	}
+	scrubbed, err := json.Marshal(r.scrubValue(value))
+	if err != nil {
+		return nil
+	}
+	return scrubbed
+}
+
+func (r *Recorder) scrubValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if _, isString := field.(string); isString && sensitiveFields[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = r.scrubValue(field)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = r.scrubValue(v[i])
+		}
+		return v
+	case string:
+		return r.scrubString(v)
+	default:
+		return v
+	}
+}
+
+func (r *Recorder) scrubString(s string) string {
+	return scrubSecrets(s, r.secrets)
+}
+
+// scrubSecrets - Replace every secret in s
+func scrubSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// Replayer - http.RoundTripper answering requests with the interactions of a cassette.
+// Interactions are matched by method, path and VERSION header and served in recorded order;
+// the last matching one is repeated once all were served.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	served       map[int]bool
+	secrets      []string
+}
+
+// LoadCassette - Read a cassette written by a Recorder
+func LoadCassette(path string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("igtest: unable to read cassette: %v", err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("igtest: unable to decode cassette %q: %v", path, err)
+	}
+	return &Replayer{interactions: cassette.Interactions, served: make(map[int]bool)}, nil
+}
+
+// Scrub - Replace the given values in request paths before matching, pass the values given to Recorder.Scrub()
+func (r *Replayer) Scrub(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+}
+
+// Option - Answer all REST requests of a client created by igmarkets.NewWithOptions() from the cassette
+func (r *Replayer) Option() igmarkets.Option {
+	return igmarkets.WithHTTPClient(&http.Client{Transport: r})
+}
+
+// RoundTrip - Implements http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	method, path, version := requestMethod(req), scrubSecrets(req.URL.Path, r.secrets), req.Header.Get("VERSION")
+	match := -1
+	for i, interaction := range r.interactions {
+		if interaction.Method != method || interaction.Path != path || interaction.Version != version {
+			continue
+		}
+		match = i
+		if !r.served[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("igtest: no recorded interaction for %s %s (version %s)", method, path, version)
+	}
+	r.served[match] = true
+	interaction := r.interactions[match]
+
+	body := []byte(interaction.ResponseBody)
+	var text string
+	if len(body) > 0 && body[0] == '"' && json.Unmarshal(body, &text) == nil {
+		body = []byte(text)
+	}
+
+	header := interaction.ResponseHeader.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// requestMethod - Method of the request including the _method override of CloseOTCPosition()
+func requestMethod(req *http.Request) string {
+	if override := req.Header.Get("_method"); override != "" {
+		return override
+	}
+	return req.Method
+}
@@ -0,0 +1,98 @@
+package igtest
+
+import (
+	"context"
+	"errors"
+	"github.com/AMekss/assert"
+	"github.com/sklinkert/igmarkets"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassette(t *testing.T) {
+	server := NewServer(t)
+	server.SetCredentials("APIKEY", "bot-user", "secret")
+	server.SetMarket(newMarket("CS.D.EURUSD.CFD.IP", 1.1000, 1.1002))
+
+	path := filepath.Join(t.TempDir(), "fixtures", "order.json")
+	recorder := NewRecorder(path, nil)
+	recorder.Scrub("ABC123", "bot-user")
+
+	igm, err := server.Client(recorder.Option(), igmarkets.WithAuthMode(igmarkets.AuthModeSessionTokens))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+	dealRef, err := igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1)})
+	assert.NoError(t, err)
+	_, err = igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	_, err = igm.GetMarkets(ctx, "CS.D.UNKNOWN.CFD.IP")
+	assert.True(t, err != nil)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	for _, secret := range []string{"APIKEY", "bot-user", "secret", "ABC123", "CST-", "XST-"} {
+		assert.False(t, strings.Contains(string(data), secret))
+	}
+
+	// Replay without server
+	server.Close()
+	replayer, err := LoadCassette(path)
+	assert.NoError(t, err)
+	igm, err = igmarkets.NewWithOptions(replayer.Option(), igmarkets.WithAuthMode(igmarkets.AuthModeSessionTokens))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(ctx))
+	dealRef, err = igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1)})
+	assert.NoError(t, err)
+	confirm, err := igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "ACCEPTED", string(confirm.DealStatus))
+	assert.EqualFloat64(t, 1.1002, confirm.Level.Float64())
+
+	_, err = igm.GetMarkets(ctx, "CS.D.UNKNOWN.CFD.IP")
+	assert.True(t, errors.Is(err, igmarkets.ErrEpicUnavailable))
+
+	_, err = igm.GetPositions(ctx)
+	assert.True(t, err != nil)
+}
+
+func TestReplayerScrubsPaths(t *testing.T) {
+	server := NewServer(t)
+	server.SetSentiment("EURUSD", igmarkets.ClientSentimentResponse{LongPositionPercentage: 60, ShortPositionPercentage: 40})
+
+	path := filepath.Join(t.TempDir(), "sentiment.json")
+	recorder := NewRecorder(path, nil)
+	recorder.Scrub("EURUSD")
+	igm, err := server.Client(recorder.Option())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+	_, err = igm.GetClientSentiment(ctx, "EURUSD")
+	assert.NoError(t, err)
+	server.Close()
+
+	// Paths are recorded as /gateway/deal/clientsentiment/REDACTED
+	replayer, err := LoadCassette(path)
+	assert.NoError(t, err)
+	igm, err = igmarkets.NewWithOptions(replayer.Option())
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(ctx))
+	_, err = igm.GetClientSentiment(ctx, "EURUSD")
+	assert.True(t, err != nil)
+
+	replayer.Scrub("EURUSD")
+	sentiment, err := igm.GetClientSentiment(ctx, "EURUSD")
+	assert.NoError(t, err)
+	assert.EqualFloat64(t, 60, sentiment.LongPositionPercentage)
+}
+
+func TestRecorderKeepsNumbers(t *testing.T) {
+	recorder := NewRecorder(filepath.Join(t.TempDir(), "numbers.json"), nil)
+	body := recorder.scrubBody([]byte(`{"dealId":12345678901234567891,"level":1.10020,"size":1e2}`))
+	assert.EqualStrings(t, `{"dealId":12345678901234567891,"level":1.10020,"size":1e2}`, string(body))
+
+	body = recorder.scrubBody([]byte(`{"level":1} trailing`))
+	assert.EqualStrings(t, `"{\"level\":1} trailing"`, string(body))
+}
@@ -0,0 +1,182 @@
+package igtest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sklinkert/igmarkets"
+	"github.com/sklinkert/igmarkets/internal/dealing"
+	"net/http"
+)
+
+// Fill - Outcome of an order decided by a FillFunc
+type Fill struct {
+	Level  igmarkets.Decimal    // Fill level, ignored if Reason is set
+	Reason igmarkets.DealReason // Reject reason, e.g. igmarkets.DealReasonMarketClosedWithEdits; empty accepts the order
+}
+
+// FillFunc - Decides whether and at which level an order is filled. market is nil for unknown epics.
+type FillFunc func(order igmarkets.OTCOrderRequest, market *igmarkets.MarketsResponse) Fill
+
+// SetFillFunc - Decide fills of new positions with the given function instead of DefaultFill
+func (s *Server) SetFillFunc(fill FillFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fill = fill
+}
+
+// DefaultFill - Fill BUY orders at the offer and SELL orders at the bid of the market snapshot.
+// Orders for unknown epics, closed markets or below the minimum deal size are rejected.
+func DefaultFill(order igmarkets.OTCOrderRequest, market *igmarkets.MarketsResponse) Fill {
+	switch {
+	case market == nil:
+		return Fill{Reason: igmarkets.DealReasonInstrumentNotValid}
+	case market.Snapshot.MarketStatus != "TRADEABLE":
+		return Fill{Reason: igmarkets.DealReasonMarketClosedWithEdits}
+	case belowMinDealSize(order.Size, market):
+		return Fill{Reason: igmarkets.DealReasonMinimumOrderSizeError}
+	case order.Direction == igmarkets.DirectionBuy:
+		return Fill{Level: market.Snapshot.Offer}
+	default:
+		return Fill{Level: market.Snapshot.Bid}
+	}
+}
+
+// Positions - Open positions
+func (s *Server) Positions() []igmarkets.Position {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.Positions()
+}
+
+// WorkingOrders - Open working orders
+func (s *Server) WorkingOrders() []igmarkets.OTCWorkingOrder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.WorkingOrders()
+}
+
+// FillWorkingOrder - Turn the working order into a position at its order level
+func (s *Server) FillWorkingOrder(dealID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, order := range s.book.WorkingOrders() {
+		if order.WorkingOrderData.DealID == dealID {
+			s.book.FillWorkingOrder(dealID, order.WorkingOrderData.OrderLevel)
+			return nil
+		}
+	}
+	return fmt.Errorf("igtest: working order %q not found", dealID)
+}
+
+func (s *Server) getPositions() igmarkets.PositionsResponse {
+	positions := s.book.Positions()
+	for i, position := range positions {
+		positions[i].MarketData = s.marketData(position.MarketData.Epic)
+	}
+	return igmarkets.PositionsResponse{Positions: positions}
+}
+
+func (s *Server) getWorkingOrders() igmarkets.WorkingOrders {
+	return igmarkets.WorkingOrders{WorkingOrders: s.book.WorkingOrders()}
+}
+
+func (s *Server) getConfirm(dealReference string) (interface{}, *apiError) {
+	confirm, found := s.book.Confirmation(dealReference)
+	if !found {
+		return nil, &apiError{http.StatusNotFound, "error.confirms.deal-not-found"}
+	}
+	return confirm, nil
+}
+
+func (s *Server) placeOrder(r *request) (interface{}, *apiError) {
+	var order igmarkets.OTCOrderRequest
+	if apiErr := r.decode(&order); apiErr != nil {
+		return nil, apiErr
+	}
+
+	fill := s.fill
+	if fill == nil {
+		fill = DefaultFill
+	}
+	result := fill(order, s.markets[order.Epic])
+	return bookResponse(s.book.PlaceOrder(order, result.Level, result.Reason))
+}
+
+func (s *Server) closePosition(r *request) (interface{}, *apiError) {
+	var close igmarkets.OTCPositionCloseRequest
+	if apiErr := r.decode(&close); apiErr != nil {
+		return nil, apiErr
+	}
+
+	level := close.Level
+	if position, found := s.book.FindPosition(close); found && !level.IsSet() {
+		level = position.Position.Level
+		if market, found := s.markets[position.MarketData.Epic]; found {
+			level = market.Snapshot.Bid
+			if close.Direction == igmarkets.DirectionBuy {
+				level = market.Snapshot.Offer
+			}
+		}
+	}
+	return s.book.ClosePosition(close, level), nil
+}
+
+func (s *Server) updatePosition(r *request, dealID string) (interface{}, *apiError) {
+	var update igmarkets.OTCUpdateOrderRequest
+	if apiErr := r.decode(&update); apiErr != nil {
+		return nil, apiErr
+	}
+	return s.book.UpdatePosition(dealID, update), nil
+}
+
+func (s *Server) placeWorkingOrder(r *request) (interface{}, *apiError) {
+	var order igmarkets.OTCWorkingOrderRequest
+	if apiErr := r.decode(&order); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var reason igmarkets.DealReason
+	market, found := s.markets[order.Epic]
+	switch {
+	case !found:
+		reason = igmarkets.DealReasonInstrumentNotValid
+	case belowMinDealSize(order.Size, market):
+		reason = igmarkets.DealReasonMinimumOrderSizeError
+	}
+	return bookResponse(s.book.PlaceWorkingOrder(order, s.marketData(order.Epic), reason))
+}
+
+func (s *Server) updateWorkingOrder(r *request, dealID string) (interface{}, *apiError) {
+	var update igmarkets.OTCUpdateWorkingOrderRequest
+	if apiErr := r.decode(&update); apiErr != nil {
+		return nil, apiErr
+	}
+	return bookResponse(s.book.UpdateWorkingOrder(dealID, update))
+}
+
+func (s *Server) deleteWorkingOrder(dealID string) (interface{}, *apiError) {
+	return bookResponse(s.book.DeleteWorkingOrder(dealID))
+}
+
+// lotSize - Contract size of new positions of the epic, unset for unknown markets
+func (s *Server) lotSize(epic string) igmarkets.Decimal {
+	if market, found := s.markets[epic]; found {
+		return market.Instrument.LotSize
+	}
+	return igmarkets.Decimal{}
+}
+
+// bookResponse - Deal reference or error response of the dealing book
+func bookResponse(dealRef *igmarkets.DealReference, err error) (interface{}, *apiError) {
+	var bookErr *dealing.Error
+	if errors.As(err, &bookErr) {
+		return nil, &apiError{bookErr.StatusCode, bookErr.ErrorCode}
+	}
+	return dealRef, nil
+}
+
+// belowMinDealSize - True if the size is not positive or below the minimum deal size of the market
+func belowMinDealSize(size igmarkets.Decimal, market *igmarkets.MarketsResponse) bool {
+	return size.Sign() <= 0 || size.Cmp(market.DealingRules.MinDealSize.Value) < 0
+}
@@ -0,0 +1,345 @@
+package igtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sklinkert/igmarkets"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// LightstreamerSession - Session created via create_session.txt
+type LightstreamerSession struct {
+	ID       string
+	User     string // LS_user, the account ID
+	Password string // LS_password, "CST-...|XST-..."
+}
+
+// LightstreamerSubscription - Subscription added via control.txt
+type LightstreamerSubscription struct {
+	SessionID string
+	Table     string   // LS_Table, e.g. "1"
+	Items     []string // e.g. "MARKET:CS.D.EURUSD.CFD.IP"
+	Schema    []string // e.g. "UPDATE_TIME", "BID", "OFFER", "MARKET_STATE"
+	Mode      string   // e.g. "MERGE"
+}
+
+// MarketUpdate - Fields of a MARKET item update. Empty fields are unchanged since the last update.
+type MarketUpdate struct {
+	UpdateTime  string // e.g. "14:14:15", London time
+	Bid         string
+	Offer       string
+	MarketState string // e.g. "TRADEABLE"
+}
+
+// LightstreamerServer - Fake of the Lightstreamer text protocol used by OpenLightStreamerSubscription().
+// Pass its URL to Server.SetLightstreamerEndpoint(). All methods are safe for concurrent use.
+type LightstreamerServer struct {
+	URL string
+
+	server        *httptest.Server
+	mu            sync.Mutex
+	sequence      int
+	sessions      []LightstreamerSession
+	subscriptions []LightstreamerSubscription
+	stream        *lightstreamerStream // Most recently bound stream
+	createError   string
+	bound         chan struct{} // Closed and replaced whenever a stream is bound
+}
+
+// lightstreamerStream - Open bind_session.txt response
+type lightstreamerStream struct {
+	sessionID string
+	messages  chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *lightstreamerStream) close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// NewLightstreamerServer - Start a fake Lightstreamer server. It is closed when the test finishes.
+func NewLightstreamerServer(t testing.TB) *LightstreamerServer {
+	s := &LightstreamerServer{bound: make(chan struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lightstreamer/create_session.txt", s.createSession)
+	mux.HandleFunc("/lightstreamer/control.txt", s.control)
+	mux.HandleFunc("/lightstreamer/bind_session.txt", s.bindSession)
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close - End the open stream and shut down the server
+func (s *LightstreamerServer) Close() {
+	s.CloseStream()
+	s.server.Close()
+}
+
+// SetCreateSessionError - Answer create_session.txt with an ERROR message, an empty message creates sessions again
+func (s *LightstreamerServer) SetCreateSessionError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createError = message
+}
+
+// Sessions - All sessions created so far
+func (s *LightstreamerServer) Sessions() []LightstreamerSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]LightstreamerSession(nil), s.sessions...)
+}
+
+// Subscriptions - All subscriptions added so far
+func (s *LightstreamerServer) Subscriptions() []LightstreamerSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]LightstreamerSubscription(nil), s.subscriptions...)
+}
+
+// WaitForStream - Wait until a stream is bound, e.g. by a reconnecting client
+func (s *LightstreamerServer) WaitForStream(timeout time.Duration) error {
+	s.mu.Lock()
+	stream, bound := s.stream, s.bound
+	s.mu.Unlock()
+	if stream != nil {
+		select {
+		case <-stream.closed:
+		default:
+			return nil
+		}
+	}
+
+	select {
+	case <-bound:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("igtest: no lightstreamer stream bound within %s", timeout)
+	}
+}
+
+// PushMarketUpdate - Send an update of the MARKET item of the given epic on the open stream
+func (s *LightstreamerServer) PushMarketUpdate(epic string, update MarketUpdate) error {
+	item := s.subscribedItem("MARKET:" + epic)
+	if item < 0 {
+		return fmt.Errorf("igtest: epic %q is not subscribed", epic)
+	}
+
+	return s.Push(fmt.Sprintf("1,%d|%s|%s|%s|%s", item, update.UpdateTime, update.Bid, update.Offer, update.MarketState))
+}
+
+// PushTradeConfirm - Send the confirmation as CONFIRMS update of the TRADE item of the given account on the open stream
+func (s *LightstreamerServer) PushTradeConfirm(accountID string, confirm igmarkets.OTCDealConfirmation) error {
+	item := s.subscribedItem("TRADE:" + accountID)
+	if item < 0 {
+		return fmt.Errorf("igtest: trades of account %q are not subscribed", accountID)
+	}
+
+	data, err := json.Marshal(&confirm)
+	if err != nil {
+		return fmt.Errorf("igtest: unable to encode confirmation: %v", err)
+	}
+	return s.Push(fmt.Sprintf("1,%d|%s", item, data))
+}
+
+// subscribedItem - Position of the item in the subscription of the open stream, -1 if not subscribed
+func (s *LightstreamerServer) subscribedItem(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := -1
+	for _, subscription := range s.subscriptions {
+		if s.stream == nil || subscription.SessionID != s.stream.sessionID {
+			continue
+		}
+		for i, subscribed := range subscription.Items {
+			if subscribed == name {
+				item = i + 1
+			}
+		}
+	}
+	return item
+}
+
+// PushProbe - Send a keepalive message
+func (s *LightstreamerServer) PushProbe() error {
+	return s.Push("PROBE")
+}
+
+// PushLoop - Ask the client to rebind the session and end the stream
+func (s *LightstreamerServer) PushLoop() error {
+	if err := s.Push("LOOP\r\n"); err != nil {
+		return err
+	}
+	s.CloseStream()
+	return nil
+}
+
+// PushEnd - Tell the client the session was closed by the server and end the stream
+func (s *LightstreamerServer) PushEnd(cause int) error {
+	if err := s.Push(fmt.Sprintf("END %d", cause)); err != nil {
+		return err
+	}
+	s.CloseStream()
+	return nil
+}
+
+// Push - Send a raw line, e.g. a malformed frame, on the open stream. "\r\n" is appended.
+func (s *LightstreamerServer) Push(line string) error {
+	s.mu.Lock()
+	stream := s.stream
+	s.mu.Unlock()
+	if stream == nil {
+		return fmt.Errorf("igtest: no lightstreamer stream bound")
+	}
+
+	select {
+	case stream.messages <- line + "\r\n":
+		return nil
+	case <-stream.closed:
+		return fmt.Errorf("igtest: lightstreamer stream of session %q is closed", stream.sessionID)
+	}
+}
+
+// CloseStream - End the open stream without LOOP or END message, like a dropped connection
+func (s *LightstreamerServer) CloseStream() {
+	s.mu.Lock()
+	stream := s.stream
+	s.mu.Unlock()
+	if stream != nil {
+		stream.close()
+	}
+}
+
+func (s *LightstreamerServer) createSession(w http.ResponseWriter, r *http.Request) {
+	form, ok := readForm(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.createError != "" {
+		_, _ = fmt.Fprintf(w, "ERROR\r\n1\r\n%s\r\n", s.createError)
+		return
+	}
+
+	s.sequence++
+	session := LightstreamerSession{
+		ID:       fmt.Sprintf("S%06d", s.sequence),
+		User:     form.Get("LS_user"),
+		Password: form.Get("LS_password"),
+	}
+	s.sessions = append(s.sessions, session)
+	_, _ = fmt.Fprintf(w, "OK\r\nSessionId:%s\r\nControlAddress:%s\r\nKeepaliveMillis:5000\r\nMaxBandwidth:0.0\r\n\r\n",
+		session.ID, r.Host)
+}
+
+func (s *LightstreamerServer) control(w http.ResponseWriter, r *http.Request) {
+	form, ok := readForm(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.hasSession(form.Get("LS_session")) {
+		_, _ = fmt.Fprint(w, "SYNC ERROR\r\n")
+		return
+	}
+	if form.Get("LS_op") == "add" {
+		// "+" separates items and fields, it is decoded as space
+		s.subscriptions = append(s.subscriptions, LightstreamerSubscription{
+			SessionID: form.Get("LS_session"),
+			Table:     form.Get("LS_Table"),
+			Items:     strings.Fields(form.Get("LS_id")),
+			Schema:    strings.Fields(form.Get("LS_schema")),
+			Mode:      form.Get("LS_mode"),
+		})
+	}
+	_, _ = fmt.Fprint(w, "OK\r\n")
+}
+
+func (s *LightstreamerServer) bindSession(w http.ResponseWriter, r *http.Request) {
+	form, ok := readForm(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	if !s.hasSession(form.Get("LS_session")) {
+		s.mu.Unlock()
+		_, _ = fmt.Fprint(w, "SYNC ERROR\r\n")
+		return
+	}
+	if s.stream != nil {
+		s.stream.close()
+	}
+	stream := &lightstreamerStream{
+		sessionID: form.Get("LS_session"),
+		messages:  make(chan string),
+		closed:    make(chan struct{}),
+	}
+	s.stream = stream
+	close(s.bound)
+	s.bound = make(chan struct{})
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case message := <-stream.messages:
+			if _, err := fmt.Fprint(w, message); err != nil {
+				stream.close()
+				return
+			}
+			flusher.Flush()
+		case <-stream.closed:
+			return
+		case <-r.Context().Done():
+			stream.close()
+			return
+		}
+	}
+}
+
+func (s *LightstreamerServer) hasSession(sessionID string) bool {
+	for _, session := range s.sessions {
+		if session.ID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+func readForm(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return form, true
+}
@@ -0,0 +1,167 @@
+package igtest
+
+import (
+	"context"
+	"github.com/AMekss/assert"
+	"github.com/sklinkert/igmarkets"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLightstreamerServer(t *testing.T) {
+	server := NewServer(t)
+	lightstreamer := NewLightstreamerServer(t)
+	server.SetLightstreamerEndpoint(lightstreamer.URL)
+
+	igm, err := server.Client()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	epics := []string{"CS.D.EURUSD.CFD.IP", "CS.D.BITCOIN.CFD.IP"}
+
+	ticks := make(chan igmarkets.LightStreamerTick)
+	assert.NoError(t, igm.OpenLightStreamerSubscription(ctx, epics, ticks))
+
+	subscriptions := lightstreamer.Subscriptions()
+	assert.EqualInt(t, 1, len(subscriptions))
+	assert.EqualStrings(t, "MARKET:CS.D.BITCOIN.CFD.IP", subscriptions[0].Items[1])
+	assert.EqualStrings(t, "MERGE", subscriptions[0].Mode)
+	assert.EqualStrings(t, "ABC123", lightstreamer.Sessions()[0].User)
+
+	assert.NoError(t, lightstreamer.PushMarketUpdate("CS.D.BITCOIN.CFD.IP",
+		MarketUpdate{UpdateTime: "14:14:15", Bid: "18230.35", Offer: "18266.35", MarketState: "TRADEABLE"}))
+	tick := <-ticks
+	assert.EqualStrings(t, "CS.D.BITCOIN.CFD.IP", tick.Epic)
+	assert.EqualFloat64(t, 18230.35, tick.Bid.Float64())
+	assert.EqualInt(t, 14, tick.Time.Hour())
+
+	// Probes, malformed frames and unparsable times are not sent to the receiver
+	assert.NoError(t, lightstreamer.PushProbe())
+	assert.NoError(t, lightstreamer.Push("1,2|garbage"))
+	assert.NoError(t, lightstreamer.PushMarketUpdate("CS.D.BITCOIN.CFD.IP", MarketUpdate{UpdateTime: "25:99"}))
+
+	// Unchanged fields are taken from the last tick
+	assert.NoError(t, lightstreamer.PushMarketUpdate("CS.D.BITCOIN.CFD.IP", MarketUpdate{Offer: "18267.00"}))
+	tick = <-ticks
+	assert.EqualFloat64(t, 18230.35, tick.Bid.Float64())
+	assert.EqualFloat64(t, 18267.00, tick.Ask.Float64())
+	assert.EqualInt(t, 15, tick.Time.Second())
+
+	// LOOP ends the stream, the client subscribes again
+	assert.NoError(t, lightstreamer.PushLoop())
+	_, open := <-ticks
+	assert.False(t, open)
+
+	ticks = make(chan igmarkets.LightStreamerTick)
+	assert.NoError(t, igm.OpenLightStreamerSubscription(ctx, epics[:1], ticks))
+	assert.NoError(t, lightstreamer.WaitForStream(time.Second))
+	assert.EqualInt(t, 2, len(lightstreamer.Sessions()))
+	assert.True(t, lightstreamer.PushMarketUpdate("CS.D.BITCOIN.CFD.IP", MarketUpdate{Bid: "1"}) != nil)
+	assert.NoError(t, lightstreamer.PushMarketUpdate("CS.D.EURUSD.CFD.IP", MarketUpdate{UpdateTime: "08:00:00", Bid: "1.1", Offer: "1.2"}))
+	tick = <-ticks
+	assert.EqualStrings(t, "CS.D.EURUSD.CFD.IP", tick.Epic)
+
+	// A dropped connection closes the receiver as well
+	lightstreamer.CloseStream()
+	_, open = <-ticks
+	assert.False(t, open)
+
+	lightstreamer.SetCreateSessionError("License limit reached")
+	assert.True(t, igm.OpenLightStreamerSubscription(ctx, epics, make(chan igmarkets.LightStreamerTick)) != nil)
+}
+
+func TestLightstreamerTradeConfirms(t *testing.T) {
+	server := NewServer(t)
+	lightstreamer := NewLightstreamerServer(t)
+	server.SetLightstreamerEndpoint(lightstreamer.URL)
+	server.SetMarket(newMarket("CS.D.EURUSD.CFD.IP", 1.1000, 1.1002))
+
+	igm, err := server.Client(igmarkets.WithConfirmPolicy(igmarkets.ConfirmPolicy{Timeout: time.Second, InitialBackoff: time.Hour}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	confirms := make(chan igmarkets.OTCDealConfirmation, 1)
+	assert.NoError(t, igm.OpenLightStreamerTradeSubscription(ctx, confirms))
+	subscriptions := lightstreamer.Subscriptions()
+	assert.EqualStrings(t, "TRADE:ABC123", subscriptions[0].Items[0])
+	assert.EqualStrings(t, "CONFIRMS", subscriptions[0].Schema[0])
+	assert.EqualStrings(t, "DISTINCT", subscriptions[0].Mode)
+
+	// The confirmation is taken from the stream, GetDealConfirmation() is not polled
+	go func() {
+		_ = lightstreamer.PushTradeConfirm("ABC123",
+			igmarkets.OTCDealConfirmation{DealReference: "REF1", DealStatus: "ACCEPTED", DealID: "DIAAAA1"})
+	}()
+	confirm, err := igm.WaitForDealConfirmation(ctx, "REF1")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "DIAAAA1", confirm.DealID)
+	assert.EqualStrings(t, "REF1", (<-confirms).DealReference)
+	server.AssertNotRequested(t, "GET", "/gateway/deal/confirms/REF1")
+
+	assert.NoError(t, lightstreamer.PushEnd(31))
+	_, open := <-confirms
+	assert.False(t, open)
+}
+
+type connectObserver struct {
+	mu          sync.Mutex
+	reconnects  []bool
+	disconnects int
+}
+
+func (o *connectObserver) ObserveSession(igmarkets.SessionEvent) {}
+func (o *connectObserver) ObserveTick(string, bool)              {}
+func (o *connectObserver) ObserveStreamConnect(reconnect bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.reconnects = append(o.reconnects, reconnect)
+}
+func (o *connectObserver) ObserveStreamDisconnect() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.disconnects++
+}
+
+func TestLightstreamerStreamConnects(t *testing.T) {
+	server := NewServer(t)
+	lightstreamer := NewLightstreamerServer(t)
+	server.SetLightstreamerEndpoint(lightstreamer.URL)
+
+	observer := &connectObserver{}
+	igm, err := server.Client(igmarkets.WithObserver(observer))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// A trade subscription next to the market subscription is not a reconnect
+	assert.NoError(t, igm.OpenLightStreamerSubscription(ctx, []string{"CS.D.EURUSD.CFD.IP"}, make(chan igmarkets.LightStreamerTick)))
+	assert.NoError(t, igm.OpenLightStreamerTradeSubscription(ctx, make(chan igmarkets.OTCDealConfirmation)))
+	assert.EqualInt(t, 1, len(observer.reconnects))
+	assert.False(t, observer.reconnects[0])
+
+}
+
+func TestLightstreamerStreamReconnects(t *testing.T) {
+	server := NewServer(t)
+	lightstreamer := NewLightstreamerServer(t)
+	server.SetLightstreamerEndpoint(lightstreamer.URL)
+
+	observer := &connectObserver{}
+	igm, err := server.Client(igmarkets.WithObserver(observer))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// The next subscription after the stream ended is a reconnect
+	ticks := make(chan igmarkets.LightStreamerTick)
+	assert.NoError(t, igm.OpenLightStreamerSubscription(ctx, []string{"CS.D.EURUSD.CFD.IP"}, ticks))
+	assert.NoError(t, lightstreamer.PushLoop())
+	for range ticks {
+	}
+	assert.NoError(t, igm.OpenLightStreamerSubscription(ctx, []string{"CS.D.EURUSD.CFD.IP"}, make(chan igmarkets.LightStreamerTick)))
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	assert.EqualInt(t, 1, observer.disconnects)
+	assert.EqualInt(t, 2, len(observer.reconnects))
+	assert.False(t, observer.reconnects[0])
+	assert.True(t, observer.reconnects[1])
+}
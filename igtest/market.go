@@ -0,0 +1,235 @@
+package igtest
+
+import (
+	"github.com/sklinkert/igmarkets"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type watchlist struct {
+	igmarkets.Watchlist
+	epics []string
+}
+
+// SetMarket - Serve the market for GET /markets/{epic} and fill orders against its snapshot.
+// The market is tradeable unless Snapshot.MarketStatus says otherwise.
+func (s *Server) SetMarket(market igmarkets.MarketsResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if market.Snapshot.MarketStatus == "" {
+		market.Snapshot.MarketStatus = "TRADEABLE"
+	}
+	s.markets[market.Instrument.Epic] = &market
+}
+
+// SetQuote - Update bid and offer of a market added by SetMarket()
+func (s *Server) SetQuote(epic string, bid, offer igmarkets.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if market, found := s.markets[epic]; found {
+		market.Snapshot.Bid = bid
+		market.Snapshot.Offer = offer
+	}
+}
+
+// SetPrices - Serve the given historical prices for GET /prices/{epic}, limited by the max parameter
+func (s *Server) SetPrices(epic string, prices igmarkets.PriceResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[epic] = &prices
+}
+
+// SetSentiment - Serve the given client sentiment for GET /clientsentiment/{marketID}
+func (s *Server) SetSentiment(marketID string, sentiment igmarkets.ClientSentimentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sentiments[marketID] = &sentiment
+}
+
+// SetAccounts - Serve the given accounts for GET /accounts. PUT /session only accepts these account IDs.
+func (s *Server) SetAccounts(accounts igmarkets.Accounts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = accounts
+}
+
+// SetPreferences - Serve the given preferences for GET /accounts/preferences
+func (s *Server) SetPreferences(preferences igmarkets.AccountsPreferences) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preferences = preferences
+}
+
+// AddActivity - Append an activity served by GET /history/activity
+func (s *Server) AddActivity(activity igmarkets.Activity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activities = append(s.activities, activity)
+}
+
+// AddTransaction - Append a transaction served by GET /history/transactions
+func (s *Server) AddTransaction(transaction igmarkets.Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions = append(s.transactions, transaction)
+}
+
+// marketData - Summary of a market as part of positions, working orders and watchlists
+func (s *Server) marketData(epic string) igmarkets.MarketData {
+	market, found := s.markets[epic]
+	if !found {
+		return igmarkets.MarketData{Epic: epic}
+	}
+	return igmarkets.MarketData{
+		Bid:                      market.Snapshot.Bid,
+		Epic:                     epic,
+		Expiry:                   market.Instrument.Expiry,
+		High:                     market.Snapshot.High,
+		InstrumentName:           market.Instrument.MarketID,
+		InstrumentType:           market.Instrument.Type,
+		LotSize:                  market.Instrument.LotSize,
+		Low:                      market.Snapshot.Low,
+		MarketStatus:             market.Snapshot.MarketStatus,
+		NetChange:                market.Snapshot.NetChange,
+		Offer:                    market.Snapshot.Offer,
+		PercentageChange:         market.Snapshot.PercentageChange,
+		ScalingFactor:            int(market.Snapshot.ScalingFactor),
+		StreamingPricesAvailable: market.Instrument.StreamingPricesAvailable,
+		UpdateTime:               market.Snapshot.UpdateTime,
+	}
+}
+
+func (s *Server) searchMarkets(term string) igmarkets.MarketSearchResponse {
+	response := igmarkets.MarketSearchResponse{Markets: []igmarkets.MarketData{}}
+	term = strings.ToLower(term)
+	for epic, market := range s.markets {
+		if strings.Contains(strings.ToLower(epic), term) || strings.Contains(strings.ToLower(market.Instrument.MarketID), term) {
+			response.Markets = append(response.Markets, s.marketData(epic))
+		}
+	}
+	return response
+}
+
+func (s *Server) getMarket(epic string) (interface{}, *apiError) {
+	market, found := s.markets[epic]
+	if !found {
+		return nil, &apiError{http.StatusNotFound, "error.service.marketdata.instrument.epic.unavailable"}
+	}
+	return market, nil
+}
+
+func (s *Server) getPrices(epic string, query url.Values) (interface{}, *apiError) {
+	prices, found := s.prices[epic]
+	if !found {
+		return nil, &apiError{http.StatusNotFound, "error.service.marketdata.instrument.epic.unavailable"}
+	}
+	response := *prices
+	if max, err := strconv.Atoi(query.Get("max")); err == nil && max > 0 && max < len(response.Prices) {
+		response.Prices = response.Prices[len(response.Prices)-max:]
+	}
+	return response, nil
+}
+
+func (s *Server) getSentiment(marketID string) (interface{}, *apiError) {
+	sentiment, found := s.sentiments[marketID]
+	if !found {
+		return nil, &apiError{http.StatusNotFound, "error.clientsentiment.market.not-found"}
+	}
+	return sentiment, nil
+}
+
+func (s *Server) getTransactions(transactionType string) igmarkets.HistoryTransactionResponse {
+	var response igmarkets.HistoryTransactionResponse
+	response.Transactions = []igmarkets.Transaction{}
+	for _, transaction := range s.transactions {
+		if transactionType == "" || transactionType == "ALL" || transaction.TransactionType == transactionType {
+			response.Transactions = append(response.Transactions, transaction)
+		}
+	}
+	response.MetaData.Size = len(response.Transactions)
+	response.MetaData.PageData.PageNumber = 1
+	response.MetaData.PageData.PageSize = len(response.Transactions)
+	response.MetaData.PageData.TotalPages = 1
+	return response
+}
+
+func (s *Server) getWatchlists() igmarkets.WatchlistsResponse {
+	response := igmarkets.WatchlistsResponse{Watchlists: []igmarkets.Watchlist{}}
+	for _, w := range s.watchlists {
+		response.Watchlists = append(response.Watchlists, w.Watchlist)
+	}
+	return response
+}
+
+func (s *Server) findWatchlist(id string) (int, *apiError) {
+	for i, w := range s.watchlists {
+		if w.ID == id {
+			return i, nil
+		}
+	}
+	return -1, &apiError{http.StatusNotFound, "error.watchlists.management.watchlist-not-found"}
+}
+
+func (s *Server) createWatchlist(r *request) (interface{}, *apiError) {
+	var create igmarkets.CreateWatchlistRequest
+	if apiErr := r.decode(&create); apiErr != nil {
+		return nil, apiErr
+	}
+	w := &watchlist{
+		Watchlist: igmarkets.Watchlist{Deleteable: true, Editable: true, ID: s.nextID(), Name: create.Name},
+		epics:     append([]string(nil), create.Epics...),
+	}
+	s.watchlists = append(s.watchlists, w)
+	return igmarkets.CreateWatchlistResponse{Status: "SUCCESS", WatchlistID: w.ID}, nil
+}
+
+func (s *Server) getWatchlist(id string) (interface{}, *apiError) {
+	i, apiErr := s.findWatchlist(id)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	response := igmarkets.WatchlistData{Markets: []igmarkets.MarketData{}}
+	for _, epic := range s.watchlists[i].epics {
+		response.Markets = append(response.Markets, s.marketData(epic))
+	}
+	return response, nil
+}
+
+func (s *Server) addToWatchlist(r *request, id string) (interface{}, *apiError) {
+	var add igmarkets.WatchlistRequest
+	if apiErr := r.decode(&add); apiErr != nil {
+		return nil, apiErr
+	}
+	i, apiErr := s.findWatchlist(id)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	s.watchlists[i].epics = append(s.watchlists[i].epics, add.Epic)
+	return map[string]string{"status": "SUCCESS"}, nil
+}
+
+func (s *Server) deleteWatchlist(id string) (interface{}, *apiError) {
+	i, apiErr := s.findWatchlist(id)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	s.watchlists = append(s.watchlists[:i], s.watchlists[i+1:]...)
+	return map[string]string{"status": "SUCCESS"}, nil
+}
+
+func (s *Server) deleteFromWatchlist(id, epic string) (interface{}, *apiError) {
+	i, apiErr := s.findWatchlist(id)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	epics := s.watchlists[i].epics[:0]
+	for _, e := range s.watchlists[i].epics {
+		if e != epic {
+			epics = append(epics, e)
+		}
+	}
+	s.watchlists[i].epics = epics
+	return map[string]string{"status": "SUCCESS"}, nil
+}
@@ -0,0 +1,422 @@
+// Package igtest provides an in-process fake of the IG REST API for tests. The Server keeps accounts, markets,
+// prices, positions, working orders, deal confirmations, watchlists, client sentiment and history in memory,
+// fills orders against the configured market snapshots, injects error responses and records all requests.
+package igtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sklinkert/igmarkets"
+	"github.com/sklinkert/igmarkets/internal/dealing"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const gatewayPrefix = "/gateway/deal"
+
+// RecordedRequest - Request received by the Server
+type RecordedRequest struct {
+	Method  string // HTTP method as sent, see the _method header for DELETE via POST
+	Path    string // e.g. /gateway/deal/positions/otc
+	Query   url.Values
+	Version int // Value of the VERSION header
+	Header  http.Header
+	Body    []byte
+}
+
+// Decode - Unmarshal the JSON body of the request into v
+func (r RecordedRequest) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Fault - Error response returned instead of handling a matching request
+type Fault struct {
+	Method     string // Matches any method if empty
+	Path       string // e.g. /gateway/deal/positions/otc; matches any path if empty
+	StatusCode int    // e.g. http.StatusForbidden; http.StatusInternalServerError if 0
+	ErrorCode  string // e.g. "error.public-api.exceeded-api-key-allowance"
+	Times      int    // Number of requests to fail, 0 fails until ClearFaults() is called
+}
+
+// Server - Fake IG REST API. All methods are safe for concurrent use.
+type Server struct {
+	URL string // Base URL for igmarkets.WithBaseURL()
+
+	server *httptest.Server
+	mu     sync.Mutex
+
+	apiKey     string
+	identifier string
+	password   string
+	accountID  string
+
+	tokens        map[string]bool // Valid OAuth access tokens, CST and X-SECURITY-TOKEN values
+	refreshTokens map[string]bool
+	tokenExpiry   int // OAuth token lifetime in seconds
+	encryptionKey *encryptionKey
+	lsEndpoint    string
+	sequence      int
+
+	accounts     igmarkets.Accounts
+	preferences  igmarkets.AccountsPreferences
+	markets      map[string]*igmarkets.MarketsResponse
+	prices       map[string]*igmarkets.PriceResponse
+	sentiments   map[string]*igmarkets.ClientSentimentResponse
+	book         *dealing.Book
+	watchlists   []*watchlist
+	activities   []igmarkets.Activity
+	transactions []igmarkets.Transaction
+	fill         FillFunc
+
+	faults   []*Fault
+	requests []RecordedRequest
+}
+
+// NewServer - Start a fake IG REST API. Any credentials are accepted unless SetCredentials() is called.
+// The server is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		accountID:     "ABC123",
+		tokens:        make(map[string]bool),
+		refreshTokens: make(map[string]bool),
+		tokenExpiry:   60,
+		markets:       make(map[string]*igmarkets.MarketsResponse),
+		prices:        make(map[string]*igmarkets.PriceResponse),
+		sentiments:    make(map[string]*igmarkets.ClientSentimentResponse),
+		book:          dealing.NewBook("DIAAAA", "REF"),
+	}
+	s.book.ContractSize = s.lotSize
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close - Shut down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client - Create a client for the server logging in with the credentials of the server
+func (s *Server) Client(opts ...igmarkets.Option) (*igmarkets.IGMarkets, error) {
+	s.mu.Lock()
+	defaults := []igmarkets.Option{
+		igmarkets.WithBaseURL(s.URL),
+		igmarkets.WithCredentials(s.apiKey, s.identifier, s.password),
+		igmarkets.WithAccountID(s.accountID),
+	}
+	s.mu.Unlock()
+	return igmarkets.NewWithOptions(append(defaults, opts...)...)
+}
+
+// SetCredentials - Only accept the given API key, identifier and password
+func (s *Server) SetCredentials(apiKey, identifier, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKey = apiKey
+	s.identifier = identifier
+	s.password = password
+}
+
+// SetAccountID - Account ID returned on login, "ABC123" by default
+func (s *Server) SetAccountID(accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accountID = accountID
+}
+
+// SetTokenExpiry - Lifetime of OAuth tokens in seconds, 60 by default
+func (s *Server) SetTokenExpiry(seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenExpiry = seconds
+}
+
+// SetLightstreamerEndpoint - Lightstreamer URL returned on login and by GET /session
+func (s *Server) SetLightstreamerEndpoint(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lsEndpoint = endpoint
+}
+
+// ExpireTokens - Invalidate all access, refresh and session tokens issued so far
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]bool)
+	s.refreshTokens = make(map[string]bool)
+}
+
+// InjectFault - Answer matching requests with the given error instead of handling them
+func (s *Server) InjectFault(fault Fault) {
+	if fault.StatusCode == 0 {
+		fault.StatusCode = http.StatusInternalServerError
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults - Remove all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests - All requests received so far
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest(nil), s.requests...)
+}
+
+// RequestsTo - Requests received with the given method and path, e.g. "GET", "/gateway/deal/positions"
+func (s *Server) RequestsTo(method, path string) []RecordedRequest {
+	var matching []RecordedRequest
+	for _, req := range s.Requests() {
+		if req.Method == method && strings.TrimRight(req.Path, "/") == strings.TrimRight(path, "/") {
+			matching = append(matching, req)
+		}
+	}
+	return matching
+}
+
+// AssertRequested - Fail the test unless the given request was received and return the last one
+func (s *Server) AssertRequested(t testing.TB, method, path string) RecordedRequest {
+	t.Helper()
+	matching := s.RequestsTo(method, path)
+	if len(matching) == 0 {
+		t.Fatalf("igtest: no %s %s request received", method, path)
+		return RecordedRequest{}
+	}
+	return matching[len(matching)-1]
+}
+
+// AssertNotRequested - Fail the test if the given request was received
+func (s *Server) AssertNotRequested(t testing.TB, method, path string) {
+	t.Helper()
+	if matching := s.RequestsTo(method, path); len(matching) > 0 {
+		t.Fatalf("igtest: %d unexpected %s %s requests received", len(matching), method, path)
+	}
+}
+
+// ResetRequests - Forget all recorded requests
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// apiError - Error response with IG's errorCode
+type apiError struct {
+	statusCode int
+	errorCode  string
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, _ := strconv.Atoi(r.Header.Get("VERSION"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, RecordedRequest{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Version: version,
+		Header:  r.Header.Clone(),
+		Body:    body,
+	})
+
+	if fault := s.matchFault(r); fault != nil {
+		writeError(w, &apiError{statusCode: fault.StatusCode, errorCode: fault.ErrorCode})
+		return
+	}
+
+	if s.apiKey != "" && r.Header.Get("X-IG-API-KEY") != s.apiKey {
+		writeError(w, &apiError{http.StatusForbidden, "error.security.api-key-invalid"})
+		return
+	}
+
+	method := r.Method
+	if override := r.Header.Get("_method"); override != "" {
+		method = override
+	}
+	path := strings.TrimRight(strings.TrimPrefix(r.URL.Path, gatewayPrefix), "/")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	req := &request{method: method, segments: segments, query: r.URL.Query(), header: r.Header, version: version, body: body}
+	if !s.isPublic(req) {
+		if apiErr := s.authorize(r); apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+	}
+
+	resp, header, apiErr := s.route(req)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	for key := range header {
+		w.Header().Set(key, header.Get(key))
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// request - Decoded request passed to the endpoint handlers
+type request struct {
+	method   string // Including the _method override
+	segments []string
+	query    url.Values
+	header   http.Header
+	version  int
+	body     []byte
+}
+
+func (r *request) is(method string, segments ...string) bool {
+	if r.method != method || len(r.segments) != len(segments) {
+		return false
+	}
+	for i, segment := range segments {
+		if segment != "*" && segment != r.segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *request) decode(v interface{}) *apiError {
+	if err := json.NewDecoder(bytes.NewReader(r.body)).Decode(v); err != nil {
+		return &apiError{http.StatusBadRequest, "validation.null-not-allowed.request"}
+	}
+	return nil
+}
+
+// route - Dispatch the request to the endpoint handler. A nil response is sent as 204 No Content.
+func (s *Server) route(r *request) (interface{}, http.Header, *apiError) {
+	switch {
+	case r.is("POST", "session"):
+		return s.login(r)
+	case r.is("GET", "session"):
+		return s.sessionDetails(r)
+	case r.is("PUT", "session"):
+		return s.switchAccount(r)
+	case r.is("DELETE", "session"):
+		return s.logout(r)
+	case r.is("POST", "session", "refresh-token"):
+		return s.refreshToken(r)
+	case r.is("GET", "session", "encryptionKey"):
+		return s.getEncryptionKey()
+	}
+
+	var resp interface{}
+	var apiErr *apiError
+	switch {
+	case r.is("GET", "accounts"):
+		resp = s.accounts
+	case r.is("GET", "accounts", "preferences"):
+		resp = s.preferences
+	case r.is("GET", "markets"):
+		resp = s.searchMarkets(r.query.Get("searchTerm"))
+	case r.is("GET", "markets", "*"):
+		resp, apiErr = s.getMarket(r.segments[1])
+	case r.is("GET", "prices", "*"):
+		resp, apiErr = s.getPrices(r.segments[1], r.query)
+	case r.is("GET", "clientsentiment", "*"):
+		resp, apiErr = s.getSentiment(r.segments[1])
+	case r.is("GET", "positions"):
+		resp = s.getPositions()
+	case r.is("POST", "positions", "otc"):
+		resp, apiErr = s.placeOrder(r)
+	case r.is("DELETE", "positions", "otc"):
+		resp, apiErr = s.closePosition(r)
+	case r.is("PUT", "positions", "otc", "*"):
+		resp, apiErr = s.updatePosition(r, r.segments[2])
+	case r.is("GET", "workingorders"):
+		resp = s.getWorkingOrders()
+	case r.is("POST", "workingorders", "otc"):
+		resp, apiErr = s.placeWorkingOrder(r)
+	case r.is("PUT", "workingorders", "otc", "*"):
+		resp, apiErr = s.updateWorkingOrder(r, r.segments[2])
+	case r.is("DELETE", "workingorders", "otc", "*"):
+		resp, apiErr = s.deleteWorkingOrder(r.segments[2])
+	case r.is("GET", "confirms", "*"):
+		resp, apiErr = s.getConfirm(r.segments[1])
+	case r.is("GET", "watchlists"):
+		resp = s.getWatchlists()
+	case r.is("POST", "watchlists"):
+		resp, apiErr = s.createWatchlist(r)
+	case r.is("GET", "watchlists", "*"):
+		resp, apiErr = s.getWatchlist(r.segments[1])
+	case r.is("PUT", "watchlists", "*"):
+		resp, apiErr = s.addToWatchlist(r, r.segments[1])
+	case r.is("DELETE", "watchlists", "*"):
+		resp, apiErr = s.deleteWatchlist(r.segments[1])
+	case r.is("DELETE", "watchlists", "*", "*"):
+		resp, apiErr = s.deleteFromWatchlist(r.segments[1], r.segments[2])
+	case r.is("GET", "history", "activity"):
+		resp = igmarkets.ActivityResponse{Activities: append([]igmarkets.Activity{}, s.activities...)}
+	case r.is("GET", "history", "transactions"):
+		resp = s.getTransactions(r.query.Get("type"))
+	default:
+		apiErr = &apiError{http.StatusNotFound, "error.request.invalid.path"}
+	}
+	return resp, nil, apiErr
+}
+
+// matchFault - Return the first fault matching the request and count it down
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for i, fault := range s.faults {
+		if fault.Method != "" && fault.Method != r.Method && fault.Method != r.Header.Get("_method") {
+			continue
+		}
+		if fault.Path != "" && strings.TrimRight(fault.Path, "/") != strings.TrimRight(r.URL.Path, "/") {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+// nextID - Unique suffix for tokens, deal IDs and references
+func (s *Server) nextID() string {
+	s.sequence++
+	return fmt.Sprintf("%06d", s.sequence)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeError(w http.ResponseWriter, apiErr *apiError) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(apiErr.statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]string{"errorCode": apiErr.errorCode})
+}
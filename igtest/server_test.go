@@ -0,0 +1,243 @@
+package igtest
+
+import (
+	"context"
+	"errors"
+	"github.com/AMekss/assert"
+	"github.com/sklinkert/igmarkets"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newMarket(epic string, bid, offer float64) igmarkets.MarketsResponse {
+	var market igmarkets.MarketsResponse
+	market.Instrument.Epic = epic
+	market.Instrument.MarketID = "EURUSD"
+	market.DealingRules.MinDealSize = igmarkets.UnitValueFloat{Unit: "POINTS", Value: igmarkets.DecimalFromFloat(0.5)}
+	market.Snapshot.Bid = igmarkets.DecimalFromFloat(bid)
+	market.Snapshot.Offer = igmarkets.DecimalFromFloat(offer)
+	return market
+}
+
+func TestServerDealing(t *testing.T) {
+	server := NewServer(t)
+	server.SetCredentials("KEY", "user", "secret")
+	server.SetMarket(newMarket("CS.D.EURUSD.CFD.IP", 1.1000, 1.1002))
+
+	igm, err := server.Client()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+
+	dealRef, err := igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{
+		Epic:          "CS.D.EURUSD.CFD.IP",
+		Direction:     "BUY",
+		OrderType:     "MARKET",
+		Size:          igmarkets.DecimalFromFloat(2),
+		StopDistance:  igmarkets.DecimalFromFloat(0.0050),
+		DealReference: "MYREF",
+	})
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "MYREF", dealRef.DealReference)
+
+	confirm, err := igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "ACCEPTED", string(confirm.DealStatus))
+	assert.EqualFloat64(t, 1.1002, confirm.Level.Float64())
+	assert.EqualFloat64(t, 1.0952, confirm.StopLevel.Float64())
+
+	positions, err := igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(positions.Positions))
+	assert.EqualStrings(t, confirm.DealID, positions.Positions[0].Position.DealID)
+
+	// Rejected orders are confirmed with a reason
+	dealRef, err = igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "SELL", Size: igmarkets.DecimalFromFloat(0.1)})
+	assert.NoError(t, err)
+	confirm, err = igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "REJECTED", string(confirm.DealStatus))
+	assert.EqualStrings(t, "MINIMUM_ORDER_SIZE_ERROR", string(confirm.Reason))
+
+	server.SetQuote("CS.D.EURUSD.CFD.IP", igmarkets.DecimalFromFloat(1.1102), igmarkets.DecimalFromFloat(1.1104))
+	dealRef, err = igm.CloseOTCPosition(ctx, igmarkets.OTCPositionCloseRequest{
+		DealID: positions.Positions[0].Position.DealID, Direction: "SELL", OrderType: "MARKET", Size: igmarkets.DecimalFromFloat(2),
+	})
+	assert.NoError(t, err)
+	confirm, err = igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "CLOSED", string(confirm.Status))
+	assert.EqualFloat64(t, 0.02, confirm.Profit.Float64())
+	assert.EqualInt(t, 0, len(server.Positions()))
+
+	req := server.AssertRequested(t, "POST", "/gateway/deal/positions/otc")
+	assert.EqualStrings(t, "DELETE", req.Header.Get("_method"))
+	assert.EqualInt(t, 1, req.Version)
+
+	_, err = igm.GetDealConfirmation(ctx, "UNKNOWN")
+	assert.True(t, errors.Is(err, igmarkets.ErrDealNotFound))
+}
+
+func TestServerNetsOppositeOrders(t *testing.T) {
+	server := NewServer(t)
+	market := newMarket("CS.D.EURUSD.CFD.IP", 1.1000, 1.1002)
+	market.Instrument.LotSize = igmarkets.DecimalFromFloat(10)
+	server.SetMarket(market)
+
+	igm, err := server.Client()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+
+	_, err = igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1)})
+	assert.NoError(t, err)
+	_, err = igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "SELL", Size: igmarkets.DecimalFromFloat(1), ForceOpen: true})
+	assert.NoError(t, err)
+	assert.EqualInt(t, 2, len(server.Positions()))
+
+	// Without forceOpen the oldest opposite position is closed and the rest of the order is opened
+	server.SetQuote("CS.D.EURUSD.CFD.IP", igmarkets.DecimalFromFloat(1.1102), igmarkets.DecimalFromFloat(1.1104))
+	dealRef, err := igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "SELL", Size: igmarkets.DecimalFromFloat(3)})
+	assert.NoError(t, err)
+	confirm, err := igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "OPEN", string(confirm.Status))
+	assert.EqualFloat64(t, 0.1, confirm.Profit.Float64())
+	positions := server.Positions()
+	assert.EqualInt(t, 2, len(positions))
+	assert.EqualStrings(t, "SELL", string(positions[1].Position.Direction))
+	assert.EqualFloat64(t, 2, positions[1].Position.Size.Float64())
+}
+
+func TestServerWorkingOrders(t *testing.T) {
+	server := NewServer(t)
+	server.SetMarket(newMarket("CS.D.EURUSD.CFD.IP", 1.1000, 1.1002))
+
+	igm, err := server.Client()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+
+	_, err = igm.PlaceOTCWorkingOrder(ctx, igmarkets.OTCWorkingOrderRequest{
+		Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1), Level: igmarkets.DecimalFromFloat(1.0900), Type: "LIMIT", LimitDistance: igmarkets.DecimalFromFloat(0.01),
+	})
+	assert.NoError(t, err)
+
+	workingOrders, err := igm.GetOTCWorkingOrders(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(workingOrders.WorkingOrders))
+	dealID := workingOrders.WorkingOrders[0].WorkingOrderData.DealID
+
+	assert.NoError(t, server.FillWorkingOrder(dealID))
+	positions := server.Positions()
+	assert.EqualInt(t, 1, len(positions))
+	assert.EqualFloat64(t, 1.1000, positions[0].Position.LimitLevel.Float64())
+
+	_, err = igm.DeleteOTCWorkingOrder(ctx, dealID)
+	assert.True(t, err != nil)
+
+	// Stop and limit may be given as levels
+	_, err = igm.PlaceOTCWorkingOrder(ctx, igmarkets.OTCWorkingOrderRequest{
+		Epic: "CS.D.EURUSD.CFD.IP", Direction: "SELL", Size: igmarkets.DecimalFromFloat(1), Level: igmarkets.DecimalFromFloat(1.1100), Type: "LIMIT",
+		StopLevel: igmarkets.DecimalFromFloat(1.1200), LimitLevel: igmarkets.DecimalFromFloat(1.0900),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, server.FillWorkingOrder(server.WorkingOrders()[0].WorkingOrderData.DealID))
+	positions = server.Positions()
+	assert.EqualInt(t, 2, len(positions))
+	assert.EqualFloat64(t, 1.1200, positions[1].Position.StopLevel.Float64())
+	assert.EqualFloat64(t, 1.0900, positions[1].Position.LimitLevel.Float64())
+}
+
+func TestServerUpdateWorkingOrder(t *testing.T) {
+	server := NewServer(t)
+	server.SetMarket(newMarket("CS.D.EURUSD.CFD.IP", 1.1000, 1.1002))
+
+	igm, err := server.Client()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+
+	_, err = igm.PlaceOTCWorkingOrder(ctx, igmarkets.OTCWorkingOrderRequest{
+		Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1), Level: igmarkets.DecimalFromFloat(1.0900), Type: "LIMIT", LimitDistance: igmarkets.DecimalFromFloat(0.01),
+	})
+	assert.NoError(t, err)
+	dealID := server.WorkingOrders()[0].WorkingOrderData.DealID
+
+	confirm, err := igm.ExecuteUpdateOTCWorkingOrder(ctx, dealID, igmarkets.OTCUpdateWorkingOrderRequest{
+		Level: igmarkets.DecimalFromFloat(1.0950), StopLevel: igmarkets.DecimalFromFloat(1.0900),
+		LimitDistance: igmarkets.DecimalFromFloat(0.01), Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED",
+	})
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "AMENDED", string(confirm.Status))
+
+	// Type and time in force are required, the level has to be positive
+	var apiErr *igmarkets.APIError
+	_, err = igm.UpdateOTCWorkingOrder(ctx, dealID, igmarkets.OTCUpdateWorkingOrderRequest{Level: igmarkets.DecimalFromFloat(1), TimeInForce: "GOOD_TILL_CANCELLED"})
+	assert.True(t, errors.As(err, &apiErr) && apiErr.ErrorCode == "validation.null-not-allowed.request.type")
+	_, err = igm.UpdateOTCWorkingOrder(ctx, dealID, igmarkets.OTCUpdateWorkingOrderRequest{Level: igmarkets.DecimalFromFloat(1), Type: "LIMIT"})
+	assert.True(t, errors.As(err, &apiErr) && apiErr.ErrorCode == "validation.null-not-allowed.request.timeInForce")
+	_, err = igm.ExecuteUpdateOTCWorkingOrder(ctx, dealID, igmarkets.OTCUpdateWorkingOrderRequest{Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED"})
+	assert.True(t, errors.Is(err, igmarkets.ErrDealRejected))
+	_, err = igm.UpdateOTCWorkingOrder(ctx, "unknown", igmarkets.OTCUpdateWorkingOrderRequest{
+		Level: igmarkets.DecimalFromFloat(1), Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED"})
+	assert.True(t, errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound)
+
+	assert.NoError(t, server.FillWorkingOrder(dealID))
+	positions := server.Positions()
+	assert.EqualInt(t, 1, len(positions))
+	assert.EqualFloat64(t, 1.0950, positions[0].Position.Level.Float64())
+	assert.EqualFloat64(t, 1.0900, positions[0].Position.StopLevel.Float64())
+	assert.EqualFloat64(t, 1.1050, positions[0].Position.LimitLevel.Float64())
+}
+
+func TestServerSessionAndFaults(t *testing.T) {
+	server := NewServer(t)
+	server.SetCredentials("KEY", "user", "secret")
+	server.SetSentiment("EURUSD", igmarkets.ClientSentimentResponse{LongPositionPercentage: 60, ShortPositionPercentage: 40})
+
+	igm, err := server.Client(igmarkets.WithEncryptedPassword(), igmarkets.WithRetryPolicy(igmarkets.RetryPolicy{
+		MaxAttempts: 2, InitialBackoff: time.Millisecond,
+	}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+
+	// Requests with an expired token are rejected until the client logs in again
+	server.ExpireTokens()
+	_, err = igm.GetClientSentiment(ctx, "EURUSD")
+	assert.True(t, errors.Is(err, igmarkets.ErrTokenInvalid))
+	assert.NoError(t, igm.Login(ctx))
+
+	server.InjectFault(Fault{Path: "/gateway/deal/clientsentiment/EURUSD", StatusCode: http.StatusServiceUnavailable, Times: 1})
+	sentiment, err := igm.GetClientSentiment(ctx, "EURUSD")
+	assert.NoError(t, err)
+	assert.EqualFloat64(t, 60, sentiment.LongPositionPercentage)
+	assert.EqualInt(t, 3, len(server.RequestsTo("GET", "/gateway/deal/clientsentiment/EURUSD")))
+
+	server.InjectFault(Fault{Method: "GET", StatusCode: http.StatusForbidden, ErrorCode: "error.public-api.exceeded-api-key-allowance"})
+	_, err = igm.GetAccountPreferences(ctx)
+	assert.True(t, errors.Is(err, igmarkets.ErrRateLimited))
+	server.ClearFaults()
+
+	// Faults without a status code fail with 500
+	server.InjectFault(Fault{Path: "/gateway/deal/clientsentiment/EURUSD"})
+	_, err = igm.GetClientSentiment(ctx, "EURUSD")
+	var apiErr *igmarkets.APIError
+	assert.True(t, errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusInternalServerError)
+	server.ClearFaults()
+
+	watchlistID, err := igm.CreateWatchlist(ctx, "FX", []string{"CS.D.EURUSD.CFD.IP"})
+	assert.NoError(t, err)
+	assert.NoError(t, igm.AddToWatchlist(ctx, watchlistID, "CS.D.GBPUSD.CFD.IP"))
+	watchlist, err := igm.GetWatchlist(ctx, watchlistID)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 2, len(watchlist.Markets))
+
+	server.SetCredentials("KEY", "user", "other")
+	igm, err = server.Client()
+	assert.NoError(t, err)
+	igm.Password = "wrong"
+	assert.True(t, errors.Is(igm.Login(ctx), igmarkets.ErrInvalidCredentials))
+}
@@ -0,0 +1,213 @@
+package igtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/sklinkert/igmarkets"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encryptionKey - RSA key pair for logins with encrypted password
+type encryptionKey struct {
+	private   *rsa.PrivateKey
+	timeStamp int64
+}
+
+type loginRequest struct {
+	Identifier        string `json:"identifier"`
+	Password          string `json:"password"`
+	EncryptedPassword bool   `json:"encryptedPassword"`
+}
+
+// isPublic - Requests that do not need an access token
+func (s *Server) isPublic(r *request) bool {
+	return r.is("POST", "session") || r.is("GET", "session", "encryptionKey") || r.is("POST", "session", "refresh-token")
+}
+
+// authorize - Check the OAuth token or the CST/X-SECURITY-TOKEN pair
+func (s *Server) authorize(r *http.Request) *apiError {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		if !s.tokens[strings.TrimPrefix(authorization, "Bearer ")] {
+			return &apiError{http.StatusUnauthorized, "error.security.oauth-token-invalid"}
+		}
+		return nil
+	}
+
+	cst, xst := r.Header.Get("CST"), r.Header.Get("X-SECURITY-TOKEN")
+	if cst == "" {
+		return &apiError{http.StatusUnauthorized, "error.security.client-token-missing"}
+	}
+	if !s.tokens[cst] || !s.tokens[xst] {
+		return &apiError{http.StatusUnauthorized, "error.security.client-token-invalid"}
+	}
+	return nil
+}
+
+// login - Version 3 returns an OAuth token, version 2 CST and X-SECURITY-TOKEN headers
+func (s *Server) login(r *request) (interface{}, http.Header, *apiError) {
+	var login loginRequest
+	if apiErr := r.decode(&login); apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	password := login.Password
+	if login.EncryptedPassword {
+		var ok bool
+		if password, ok = s.decryptPassword(password); !ok {
+			return nil, nil, &apiError{http.StatusUnauthorized, "error.security.invalid-details"}
+		}
+	}
+	if s.identifier != "" && (login.Identifier != s.identifier || password != s.password) {
+		return nil, nil, &apiError{http.StatusUnauthorized, "error.security.invalid-details"}
+	}
+
+	if r.version == 3 {
+		return map[string]interface{}{
+			"clientId":              "CLIENT",
+			"accountId":             s.accountID,
+			"lightstreamerEndpoint": s.lsEndpoint,
+			"oauthToken":            s.newOAuthToken(),
+			"timezoneOffset":        0,
+		}, nil, nil
+	}
+
+	header := s.newSessionTokens()
+	return igmarkets.SessionVersion2{
+		AccountType:           igmarkets.AccountTypeCFD,
+		CurrencyIsoCode:       "EUR",
+		CurrencySymbol:        "E",
+		CurrentAccountId:      s.accountID,
+		LightstreamerEndpoint: s.lsEndpoint,
+		ClientID:              "CLIENT",
+		TrailingStopsEnabled:  s.preferences.TrailingStopsEnabled,
+		DealingEnabled:        true,
+	}, header, nil
+}
+
+func (s *Server) sessionDetails(r *request) (interface{}, http.Header, *apiError) {
+	var header http.Header
+	if r.query.Get("fetchSessionTokens") == "true" {
+		header = s.newSessionTokens()
+	}
+	return igmarkets.SessionDetails{
+		ClientID:              "CLIENT",
+		AccountID:             s.accountID,
+		Locale:                "en_GB",
+		Currency:              "EUR",
+		LightstreamerEndpoint: s.lsEndpoint,
+	}, header, nil
+}
+
+func (s *Server) switchAccount(r *request) (interface{}, http.Header, *apiError) {
+	var switchRequest struct {
+		AccountID string `json:"accountId"`
+	}
+	if apiErr := r.decode(&switchRequest); apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if len(s.accounts.Accounts) > 0 {
+		var found bool
+		for _, account := range s.accounts.Accounts {
+			found = found || account.AccountId == switchRequest.AccountID
+		}
+		if !found {
+			return nil, nil, &apiError{http.StatusUnauthorized, "error.security.account-not-found"}
+		}
+	}
+	s.accountID = switchRequest.AccountID
+	return igmarkets.SwitchAccountResponse{
+		TrailingStopsEnabled: s.preferences.TrailingStopsEnabled,
+		DealingEnabled:       true,
+	}, nil, nil
+}
+
+func (s *Server) logout(r *request) (interface{}, http.Header, *apiError) {
+	delete(s.tokens, strings.TrimPrefix(r.header.Get("Authorization"), "Bearer "))
+	delete(s.tokens, r.header.Get("CST"))
+	delete(s.tokens, r.header.Get("X-SECURITY-TOKEN"))
+	return nil, nil, nil
+}
+
+func (s *Server) refreshToken(r *request) (interface{}, http.Header, *apiError) {
+	var refresh struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if apiErr := r.decode(&refresh); apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if !s.refreshTokens[refresh.RefreshToken] {
+		return nil, nil, &apiError{http.StatusUnauthorized, "error.security.oauth-token-invalid"}
+	}
+	delete(s.refreshTokens, refresh.RefreshToken)
+	return s.newOAuthToken(), nil, nil
+}
+
+func (s *Server) getEncryptionKey() (interface{}, http.Header, *apiError) {
+	if s.encryptionKey == nil {
+		private, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			return nil, nil, &apiError{http.StatusInternalServerError, "error.unexpected"}
+		}
+		s.encryptionKey = &encryptionKey{private: private, timeStamp: time.Now().UnixMilli()}
+	}
+	der, err := x509.MarshalPKIXPublicKey(&s.encryptionKey.private.PublicKey)
+	if err != nil {
+		return nil, nil, &apiError{http.StatusInternalServerError, "error.unexpected"}
+	}
+	return igmarkets.EncryptionKey{
+		EncryptionKey: base64.StdEncoding.EncodeToString(der),
+		TimeStamp:     s.encryptionKey.timeStamp,
+	}, nil, nil
+}
+
+// decryptPassword - Reverse the encryption of base64(password|timestamp)
+func (s *Server) decryptPassword(encrypted string) (string, bool) {
+	if s.encryptionKey == nil {
+		return "", false
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", false
+	}
+	plaintext, err := rsa.DecryptPKCS1v15(rand.Reader, s.encryptionKey.private, ciphertext)
+	if err != nil {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(plaintext))
+	if err != nil {
+		return "", false
+	}
+	suffix := "|" + strconv.FormatInt(s.encryptionKey.timeStamp, 10)
+	if !strings.HasSuffix(string(decoded), suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(string(decoded), suffix), true
+}
+
+func (s *Server) newOAuthToken() igmarkets.OAuthToken {
+	token := igmarkets.OAuthToken{
+		AccessToken:  "ACCESS-" + s.nextID(),
+		RefreshToken: "REFRESH-" + s.nextID(),
+		ExpiresIn:    strconv.Itoa(s.tokenExpiry),
+		Scope:        "profile",
+		TokenType:    "Bearer",
+	}
+	s.tokens[token.AccessToken] = true
+	s.refreshTokens[token.RefreshToken] = true
+	return token
+}
+
+func (s *Server) newSessionTokens() http.Header {
+	cst, xst := "CST-"+s.nextID(), "XST-"+s.nextID()
+	s.tokens[cst] = true
+	s.tokens[xst] = true
+	header := http.Header{}
+	header.Set("CST", cst)
+	header.Set("X-SECURITY-TOKEN", xst)
+	return header
+}
@@ -0,0 +1,555 @@
+// Package dealing keeps the in-memory dealing book shared by the paper trader and the fake IG API of igtest:
+// positions, working orders and deal confirmations, filled and closed the way IG does.
+package dealing
+
+import (
+	"fmt"
+	"github.com/sklinkert/igmarkets"
+	"net/http"
+	"time"
+)
+
+// Close reasons of Trade
+const (
+	CloseManual = "CLOSE"
+	CloseStop   = "STOP"
+	CloseLimit  = "LIMIT"
+)
+
+// goodTillDateFormat - Format of OTCWorkingOrderRequest.GoodTillDate
+const goodTillDateFormat = "2006/01/02 15:04"
+
+// Trade - Position (partially) closed by the book
+type Trade struct {
+	DealID     string
+	Epic       string
+	Direction  igmarkets.Direction // Direction of the position
+	Size       igmarkets.Decimal
+	OpenLevel  igmarkets.Decimal
+	CloseLevel igmarkets.Decimal
+	Profit     igmarkets.Decimal // (CloseLevel - OpenLevel) * Size * ContractSize, negated for SELL positions
+	Reason     string            // CloseManual, CloseStop or CloseLimit
+	ClosedAt   time.Time
+}
+
+// Error - Error response IG would have sent for the request
+type Error struct {
+	StatusCode int
+	ErrorCode  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dealing: %d %s", e.StatusCode, e.ErrorCode)
+}
+
+// Book - Positions, working orders and confirmations. Not safe for concurrent use.
+type Book struct {
+	DealIDPrefix    string                              // Prefix of generated deal IDs, e.g. "DIAAAA"
+	ReferencePrefix string                              // Prefix of generated deal references
+	Now             func() time.Time                    // Creation time of positions and orders, expiry of working orders
+	ContractSize    func(epic string) igmarkets.Decimal // Contract size of new positions, 1 if nil or not positive
+
+	positions []igmarkets.Position
+	orders    []igmarkets.OTCWorkingOrder
+	confirms  map[string]*igmarkets.OTCDealConfirmation
+	trades    []Trade
+	sequence  int
+}
+
+// NewBook - Create an empty book
+func NewBook(dealIDPrefix, referencePrefix string) *Book {
+	return &Book{
+		DealIDPrefix:    dealIDPrefix,
+		ReferencePrefix: referencePrefix,
+		Now:             time.Now,
+		confirms:        make(map[string]*igmarkets.OTCDealConfirmation),
+	}
+}
+
+// Positions - Open positions, oldest first
+func (b *Book) Positions() []igmarkets.Position {
+	return append([]igmarkets.Position{}, b.positions...)
+}
+
+// WorkingOrders - Pending working orders, oldest first
+func (b *Book) WorkingOrders() []igmarkets.OTCWorkingOrder {
+	return append([]igmarkets.OTCWorkingOrder{}, b.orders...)
+}
+
+// Trades - Positions closed so far, oldest first
+func (b *Book) Trades() []Trade {
+	return append([]Trade(nil), b.trades...)
+}
+
+// Confirmation - Copy of the confirmation stored under the deal reference
+func (b *Book) Confirmation(dealReference string) (*igmarkets.OTCDealConfirmation, bool) {
+	confirm, found := b.confirms[dealReference]
+	if !found {
+		return nil, false
+	}
+	copied := *confirm
+	return &copied, true
+}
+
+// PlaceOrder - Fill the order at level or reject it if reason is set. A position in the opposite direction is
+// reduced unless forceOpen is set. If the order is larger, the position is closed and the rest of the order is
+// opened in the new direction.
+func (b *Book) PlaceOrder(order igmarkets.OTCOrderRequest, level igmarkets.Decimal, reason igmarkets.DealReason) (*igmarkets.DealReference, error) {
+	if _, duplicate := b.confirms[order.DealReference]; duplicate {
+		return nil, &Error{http.StatusBadRequest, "error.service.create.otc.position.duplicate-deal-reference"}
+	}
+
+	confirm := &igmarkets.OTCDealConfirmation{
+		Epic:          order.Epic,
+		Direction:     order.Direction,
+		Size:          order.Size,
+		OrderType:     order.OrderType,
+		CurrencyCode:  order.CurrencyCode,
+		Expiry:        order.Expiry,
+		ForceOpen:     order.ForceOpen,
+		TimeInForce:   order.TimeInForce,
+		TrailingStop:  order.TrailingStop,
+		AffectedDeals: []igmarkets.AffectedDeal{},
+	}
+	if reason != "" {
+		return b.reject(order.DealReference, confirm, reason), nil
+	}
+
+	size := order.Size
+	var closed []igmarkets.AffectedDeal
+	if !order.ForceOpen {
+		if i := b.findOpposite(order.Epic, order.Direction); i >= 0 {
+			opposite := b.positions[i]
+			if size.Cmp(opposite.Position.Size) <= 0 {
+				return b.close(i, size, level, CloseManual, order.DealReference, confirm), nil
+			}
+			trade := b.recordTrade(opposite, opposite.Position.Size, level, CloseManual)
+			b.positions = append(b.positions[:i], b.positions[i+1:]...)
+			size = size.Sub(opposite.Position.Size)
+			confirm.Profit = trade.Profit
+			confirm.ProfitCurrency = opposite.Position.Currency
+			closed = []igmarkets.AffectedDeal{{DealID: opposite.Position.DealID, Constant: "FULLY_CLOSED"}}
+		}
+	}
+
+	position := b.newPosition(order.Epic, order.Direction, order.CurrencyCode, size, level, order.DealReference)
+	position.Position.StopLevel = stopOrLimitLevel(level, order.StopLevel, order.StopDistance, order.Direction, false)
+	position.Position.LimitLevel = stopOrLimitLevel(level, order.LimitLevel, order.LimitDistance, order.Direction, true)
+	b.positions = append(b.positions, position)
+
+	confirm.DealID = position.Position.DealID
+	confirm.DealStatus = igmarkets.DealStatusAccepted
+	confirm.Status = igmarkets.PositionStatusOpen
+	confirm.Reason = igmarkets.DealReasonSuccess
+	confirm.Level = level
+	confirm.StopLevel = position.Position.StopLevel
+	confirm.LimitLevel = position.Position.LimitLevel
+	confirm.GuaranteedStop = order.GuaranteedStop
+	confirm.AffectedDeals = append(closed, igmarkets.AffectedDeal{DealID: confirm.DealID, Constant: "OPENED"})
+	return b.confirm(order.DealReference, confirm), nil
+}
+
+// FindPosition - Position to close by deal ID or by epic and opposite direction
+func (b *Book) FindPosition(close igmarkets.OTCPositionCloseRequest) (igmarkets.Position, bool) {
+	if i := b.findPosition(close); i >= 0 {
+		return b.positions[i], true
+	}
+	return igmarkets.Position{}, false
+}
+
+// ClosePosition - Reduce or close the position at level. Sizes above the position size close the whole position.
+func (b *Book) ClosePosition(close igmarkets.OTCPositionCloseRequest, level igmarkets.Decimal) *igmarkets.DealReference {
+	confirm := &igmarkets.OTCDealConfirmation{
+		Epic:          close.Epic,
+		Direction:     close.Direction,
+		Size:          close.Size,
+		OrderType:     close.OrderType,
+		TimeInForce:   close.TimeInForce,
+		AffectedDeals: []igmarkets.AffectedDeal{},
+	}
+	i := b.findPosition(close)
+	if i < 0 {
+		return b.reject("", confirm, igmarkets.DealReasonPositionNotFound)
+	}
+	return b.close(i, close.Size, level, CloseManual, "", confirm)
+}
+
+// UpdatePosition - Replace stop and limit level of the position
+func (b *Book) UpdatePosition(dealID string, update igmarkets.OTCUpdateOrderRequest) *igmarkets.DealReference {
+	confirm := &igmarkets.OTCDealConfirmation{DealID: dealID, AffectedDeals: []igmarkets.AffectedDeal{}}
+	for i := range b.positions {
+		position := &b.positions[i].Position
+		if position.DealID != dealID {
+			continue
+		}
+		position.StopLevel = update.StopLevel
+		position.LimitLevel = update.LimitLevel
+		confirm.Epic = b.positions[i].MarketData.Epic
+		confirm.Direction = position.Direction
+		confirm.Size = position.Size
+		confirm.Level = position.Level
+		confirm.StopLevel = update.StopLevel
+		confirm.LimitLevel = update.LimitLevel
+		confirm.TrailingStop = update.TrailingStop
+		confirm.DealStatus = igmarkets.DealStatusAccepted
+		confirm.Status = igmarkets.PositionStatusAmended
+		confirm.Reason = igmarkets.DealReasonSuccess
+		confirm.AffectedDeals = []igmarkets.AffectedDeal{{DealID: dealID, Constant: "AMENDED"}}
+		return b.confirm("", confirm)
+	}
+	return b.reject("", confirm, igmarkets.DealReasonPositionNotFound)
+}
+
+// PlaceWorkingOrder - Add the working order to the book or reject it if reason is set.
+// Stop and limit levels are stored as distances from the order level, as IG does.
+func (b *Book) PlaceWorkingOrder(order igmarkets.OTCWorkingOrderRequest, market igmarkets.MarketData, reason igmarkets.DealReason) (*igmarkets.DealReference, error) {
+	if _, duplicate := b.confirms[order.DealReference]; duplicate {
+		return nil, &Error{http.StatusBadRequest, "error.service.create.otc.position.duplicate-deal-reference"}
+	}
+
+	confirm := &igmarkets.OTCDealConfirmation{
+		Epic:          order.Epic,
+		Direction:     order.Direction,
+		Size:          order.Size,
+		Level:         order.Level,
+		CurrencyCode:  order.CurrencyCode,
+		Expiry:        order.Expiry,
+		TimeInForce:   order.TimeInForce,
+		AffectedDeals: []igmarkets.AffectedDeal{},
+	}
+	if reason != "" {
+		return b.reject(order.DealReference, confirm, reason), nil
+	}
+
+	now := b.Now().UTC()
+	workingOrder := igmarkets.OTCWorkingOrder{
+		MarketData: market,
+		WorkingOrderData: igmarkets.WorkingOrderData{
+			CreatedDate:    now.Format("2006/01/02 15:04:05:000"),
+			CreatedDateUTC: now.Format("2006-01-02T15:04:05"),
+			CurrencyCode:   order.CurrencyCode,
+			DealID:         b.nextID(b.DealIDPrefix),
+			Direction:      order.Direction,
+			Epic:           order.Epic,
+			GoodTillDate:   order.GoodTillDate,
+			GuaranteedStop: order.GuaranteedStop,
+			LimitDistance:  stopOrLimitDistance(order.Level, order.LimitLevel, order.LimitDistance),
+			OrderLevel:     order.Level,
+			OrderSize:      order.Size,
+			OrderType:      order.Type,
+			StopDistance:   stopOrLimitDistance(order.Level, order.StopLevel, order.StopDistance),
+			TimeInForce:    order.TimeInForce,
+		},
+	}
+	b.orders = append(b.orders, workingOrder)
+
+	confirm.DealID = workingOrder.WorkingOrderData.DealID
+	confirm.DealStatus = igmarkets.DealStatusAccepted
+	confirm.Status = igmarkets.PositionStatusOpen
+	confirm.Reason = igmarkets.DealReasonSuccess
+	confirm.AffectedDeals = []igmarkets.AffectedDeal{{DealID: confirm.DealID, Constant: "OPENED"}}
+	return b.confirm(order.DealReference, confirm), nil
+}
+
+// UpdateWorkingOrder - Replace level, stop, limit, expiry and type of the working order
+func (b *Book) UpdateWorkingOrder(dealID string, update igmarkets.OTCUpdateWorkingOrderRequest) (*igmarkets.DealReference, error) {
+	switch {
+	case update.Type == "":
+		return nil, &Error{http.StatusBadRequest, "validation.null-not-allowed.request.type"}
+	case update.TimeInForce == "":
+		return nil, &Error{http.StatusBadRequest, "validation.null-not-allowed.request.timeInForce"}
+	}
+
+	for i := range b.orders {
+		data := &b.orders[i].WorkingOrderData
+		if data.DealID != dealID {
+			continue
+		}
+		confirm := &igmarkets.OTCDealConfirmation{
+			Epic:          data.Epic,
+			DealID:        dealID,
+			Direction:     data.Direction,
+			Size:          data.OrderSize,
+			Level:         update.Level,
+			TimeInForce:   update.TimeInForce,
+			AffectedDeals: []igmarkets.AffectedDeal{},
+		}
+		if update.Level.Sign() <= 0 {
+			return b.reject("", confirm, igmarkets.DealReasonUnknown), nil
+		}
+
+		data.OrderLevel = update.Level
+		data.StopDistance = stopOrLimitDistance(update.Level, update.StopLevel, update.StopDistance)
+		data.LimitDistance = stopOrLimitDistance(update.Level, update.LimitLevel, update.LimitDistance)
+		data.GoodTillDate = update.GoodTillDate
+		data.OrderType = update.Type
+		data.TimeInForce = update.TimeInForce
+
+		confirm.DealStatus = igmarkets.DealStatusAccepted
+		confirm.Status = igmarkets.PositionStatusAmended
+		confirm.Reason = igmarkets.DealReasonSuccess
+		confirm.AffectedDeals = []igmarkets.AffectedDeal{{DealID: dealID, Constant: "AMENDED"}}
+		return b.confirm("", confirm), nil
+	}
+	return nil, &Error{http.StatusNotFound, "error.service.otc.workingorder.notfound"}
+}
+
+// DeleteWorkingOrder - Remove the working order from the book
+func (b *Book) DeleteWorkingOrder(dealID string) (*igmarkets.DealReference, error) {
+	for i, order := range b.orders {
+		data := order.WorkingOrderData
+		if data.DealID != dealID {
+			continue
+		}
+		b.orders = append(b.orders[:i], b.orders[i+1:]...)
+		return b.confirm("", &igmarkets.OTCDealConfirmation{
+			Epic:          data.Epic,
+			DealID:        dealID,
+			Direction:     data.Direction,
+			Size:          data.OrderSize,
+			Level:         data.OrderLevel,
+			DealStatus:    igmarkets.DealStatusAccepted,
+			Status:        igmarkets.PositionStatusDeleted,
+			Reason:        igmarkets.DealReasonSuccess,
+			AffectedDeals: []igmarkets.AffectedDeal{{DealID: dealID, Constant: "DELETED"}},
+		}), nil
+	}
+	return nil, &Error{http.StatusNotFound, "error.service.otc.workingorder.notfound"}
+}
+
+// FillWorkingOrder - Turn the working order into a position at level, false if it does not exist
+func (b *Book) FillWorkingOrder(dealID string, level igmarkets.Decimal) bool {
+	for i, order := range b.orders {
+		if order.WorkingOrderData.DealID != dealID {
+			continue
+		}
+		b.fillWorkingOrder(order.WorkingOrderData, level)
+		b.orders = append(b.orders[:i], b.orders[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// Trigger - Close positions of the epic whose stop or limit was hit by the quote, turn triggered working orders
+// into positions and remove expired ones
+func (b *Book) Trigger(epic string, bid, ask igmarkets.Decimal) {
+	open := b.positions[:0]
+	for _, position := range b.positions {
+		details := position.Position
+		if position.MarketData.Epic != epic {
+			open = append(open, position)
+			continue
+		}
+
+		level := bid
+		if details.Direction == igmarkets.DirectionSell {
+			level = ask
+		}
+		reason := ""
+		switch {
+		case !details.StopLevel.IsZero() && gain(details.StopLevel, level, details.Direction).Sign() <= 0:
+			reason = CloseStop
+		case !details.LimitLevel.IsZero() && gain(details.LimitLevel, level, details.Direction).Sign() >= 0:
+			reason = CloseLimit
+		}
+		if reason == "" {
+			open = append(open, position)
+			continue
+		}
+		b.recordTrade(position, details.Size, level, reason)
+	}
+	b.positions = open
+
+	now := b.Now()
+	pending := b.orders[:0]
+	for _, order := range b.orders {
+		data := order.WorkingOrderData
+		if data.Epic != epic {
+			pending = append(pending, order)
+			continue
+		}
+		if data.TimeInForce == igmarkets.TimeInForceGoodTillDate && data.GoodTillDate != "" {
+			if goodTill, err := time.Parse(goodTillDateFormat, data.GoodTillDate); err == nil && now.UTC().After(goodTill) {
+				continue
+			}
+		}
+
+		level := ask
+		if data.Direction == igmarkets.DirectionSell {
+			level = bid
+		}
+		// LIMIT orders wait for a better, STOP orders for a worse price than the order level
+		triggered := gain(level, data.OrderLevel, data.Direction).Sign() <= 0
+		if data.OrderType == igmarkets.WorkingOrderTypeLimit {
+			triggered = gain(level, data.OrderLevel, data.Direction).Sign() >= 0
+		}
+		if !triggered {
+			pending = append(pending, order)
+			continue
+		}
+		b.fillWorkingOrder(data, level)
+	}
+	b.orders = pending
+}
+
+// fillWorkingOrder - Open the position of the working order at level
+func (b *Book) fillWorkingOrder(data igmarkets.WorkingOrderData, level igmarkets.Decimal) {
+	position := b.newPosition(data.Epic, data.Direction, data.CurrencyCode, data.OrderSize, level, "")
+	position.Position.DealID = data.DealID
+	if !data.StopDistance.IsZero() {
+		position.Position.StopLevel = levelAtDistance(level, data.StopDistance, data.Direction, false)
+	}
+	if !data.LimitDistance.IsZero() {
+		position.Position.LimitLevel = levelAtDistance(level, data.LimitDistance, data.Direction, true)
+	}
+	b.positions = append(b.positions, position)
+}
+
+// close - Reduce or close the position at index i
+func (b *Book) close(i int, size, level igmarkets.Decimal, reason, dealReference string, confirm *igmarkets.OTCDealConfirmation) *igmarkets.DealReference {
+	position := b.positions[i]
+	if size.Cmp(position.Position.Size) > 0 {
+		size = position.Position.Size
+	}
+	trade := b.recordTrade(position, size, level, reason)
+
+	confirm.Epic = position.MarketData.Epic
+	confirm.DealID = position.Position.DealID
+	confirm.DealStatus = igmarkets.DealStatusAccepted
+	confirm.Reason = igmarkets.DealReasonSuccess
+	confirm.Level = level
+	confirm.Size = size
+	confirm.Profit = trade.Profit
+	confirm.ProfitCurrency = position.Position.Currency
+	if size.Cmp(position.Position.Size) < 0 {
+		b.positions[i].Position.Size = position.Position.Size.Sub(size)
+		confirm.Status = igmarkets.PositionStatusPartiallyClosed
+		confirm.AffectedDeals = []igmarkets.AffectedDeal{{DealID: confirm.DealID, Constant: "PARTIALLY_CLOSED"}}
+	} else {
+		b.positions = append(b.positions[:i], b.positions[i+1:]...)
+		confirm.Status = igmarkets.PositionStatusClosed
+		confirm.AffectedDeals = []igmarkets.AffectedDeal{{DealID: confirm.DealID, Constant: "FULLY_CLOSED"}}
+	}
+	return b.confirm(dealReference, confirm)
+}
+
+// recordTrade - Add the closed (part of the) position to the trades
+func (b *Book) recordTrade(position igmarkets.Position, size, level igmarkets.Decimal, reason string) Trade {
+	details := position.Position
+	trade := Trade{
+		DealID:     details.DealID,
+		Epic:       position.MarketData.Epic,
+		Direction:  details.Direction,
+		Size:       size,
+		OpenLevel:  details.Level,
+		CloseLevel: level,
+		Profit:     gain(details.Level, level, details.Direction).Mul(size).Mul(details.ContractSize),
+		Reason:     reason,
+		ClosedAt:   b.Now(),
+	}
+	b.trades = append(b.trades, trade)
+	return trade
+}
+
+// findPosition - Index of the position to close by deal ID or epic and opposite direction, -1 if not found
+func (b *Book) findPosition(close igmarkets.OTCPositionCloseRequest) int {
+	if close.DealID == "" {
+		return b.findOpposite(close.Epic, close.Direction)
+	}
+	for i, position := range b.positions {
+		if position.Position.DealID == close.DealID {
+			return i
+		}
+	}
+	return -1
+}
+
+// findOpposite - Index of the oldest position of the epic in the opposite direction, -1 if not found
+func (b *Book) findOpposite(epic string, direction igmarkets.Direction) int {
+	for i, position := range b.positions {
+		if position.MarketData.Epic == epic && position.Position.Direction != direction {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *Book) newPosition(epic string, direction igmarkets.Direction, currency string, size, level igmarkets.Decimal, dealReference string) igmarkets.Position {
+	var position igmarkets.Position
+	now := b.Now().UTC()
+	position.MarketData.Epic = epic
+	position.Position.DealID = b.nextID(b.DealIDPrefix)
+	position.Position.DealReference = dealReference
+	position.Position.Direction = direction
+	position.Position.Currency = currency
+	position.Position.Size = size
+	position.Position.Level = level
+	position.Position.ContractSize = igmarkets.NewDecimal(1, 0)
+	if b.ContractSize != nil {
+		if contractSize := b.ContractSize(epic); contractSize.Sign() > 0 {
+			position.Position.ContractSize = contractSize
+		}
+	}
+	position.Position.CreatedDate = now.Format("2006/01/02 15:04:05:000")
+	position.Position.CreatedDateUTC = now.Format("2006-01-02T15:04:05")
+	return position
+}
+
+// confirm - Store the confirmation under the (generated) deal reference
+func (b *Book) confirm(dealReference string, confirm *igmarkets.OTCDealConfirmation) *igmarkets.DealReference {
+	if dealReference == "" {
+		dealReference = b.nextID(b.ReferencePrefix)
+	}
+	confirm.DealReference = dealReference
+	b.confirms[dealReference] = confirm
+	return &igmarkets.DealReference{DealReference: dealReference}
+}
+
+// reject - Store a REJECTED confirmation
+func (b *Book) reject(dealReference string, confirm *igmarkets.OTCDealConfirmation, reason igmarkets.DealReason) *igmarkets.DealReference {
+	confirm.DealStatus = igmarkets.DealStatusRejected
+	confirm.Reason = reason
+	return b.confirm(dealReference, confirm)
+}
+
+func (b *Book) nextID(prefix string) string {
+	b.sequence++
+	return fmt.Sprintf("%s%06d", prefix, b.sequence)
+}
+
+// gain - Points gained by a position in the given direction when the price moves from one level to another
+func gain(from, to igmarkets.Decimal, direction igmarkets.Direction) igmarkets.Decimal {
+	if direction == igmarkets.DirectionSell {
+		return from.Sub(to)
+	}
+	return to.Sub(from)
+}
+
+// stopOrLimitLevel - Level of a stop or limit given as absolute level or as distance from the fill level, unset if none
+func stopOrLimitLevel(fillLevel, level, distance igmarkets.Decimal, direction igmarkets.Direction, limit bool) igmarkets.Decimal {
+	if level.IsSet() {
+		return level
+	}
+	if distance.IsSet() {
+		return levelAtDistance(fillLevel, distance, direction, limit)
+	}
+	return igmarkets.Decimal{}
+}
+
+// levelAtDistance - Level of a stop or limit at the distance from level. Limits are above BUY and below SELL
+// positions, stops the other way round.
+func levelAtDistance(level, distance igmarkets.Decimal, direction igmarkets.Direction, limit bool) igmarkets.Decimal {
+	if (direction == igmarkets.DirectionBuy) != limit {
+		distance = distance.Neg()
+	}
+	return level.Add(distance)
+}
+
+// stopOrLimitDistance - Distance of a stop or limit given as absolute level or as distance from the order level,
+// unset if none
+func stopOrLimitDistance(orderLevel, level, distance igmarkets.Decimal) igmarkets.Decimal {
+	if level.IsSet() {
+		return level.Sub(orderLevel).Abs()
+	}
+	return distance
+}
@@ -1,13 +1,14 @@
 package igmarkets
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -15,8 +16,8 @@ import (
 type LightStreamerTick struct {
 	Epic string
 	Time time.Time
-	Bid  float64
-	Ask  float64
+	Bid  Decimal
+	Ask  Decimal
 }
 
 const lightStreamerContentType = "application/x-www-form-urlencoded"
@@ -40,6 +41,44 @@ func (ig *IGMarkets) OpenLightStreamerSubscription(ctx context.Context, epics []
 	ig.TimeZoneLightStreamer = timeZone
 	ig.Unlock()
 
+	var items []string
+	for _, epic := range epics {
+		items = append(items, "MARKET:"+epic)
+	}
+	sessionID, httpStream, err := ig.openLightStreamerSession(sessionVersion2, items, "UPDATE_TIME+BID+OFFER+MARKET_STATE", "MERGE")
+	if err != nil {
+		return err
+	}
+
+	ig.observeStreamConnect()
+	go ig.lightstreamerReadSubscription(sessionID, epics, tickReceiver, httpStream)
+
+	return nil
+}
+
+// OpenLightStreamerTradeSubscription - Subscribe to the TRADE CONFIRMS feed of the current account.
+// confirmReceiver receives every deal confirmation and is closed when the stream ends; it may be nil.
+// While the stream is open, the Execute methods return as soon as their confirmation is streamed.
+func (ig *IGMarkets) OpenLightStreamerTradeSubscription(ctx context.Context, confirmReceiver chan OTCDealConfirmation) error {
+	// Obtain CST and XST tokens first
+	sessionVersion2, err := ig.LoginVersion2(ctx)
+	if err != nil {
+		return fmt.Errorf("ig.LoginVersion2() failed: %v", err)
+	}
+
+	items := []string{"TRADE:" + sessionVersion2.CurrentAccountId}
+	sessionID, httpStream, err := ig.openLightStreamerSession(sessionVersion2, items, "CONFIRMS", "DISTINCT")
+	if err != nil {
+		return err
+	}
+
+	go ig.lightstreamerReadTradeSubscription(sessionID, confirmReceiver, httpStream)
+
+	return nil
+}
+
+// openLightStreamerSession - Create a session with a single table of the given items and bind to its stream
+func (ig *IGMarkets) openLightStreamerSession(sessionVersion2 *SessionVersion2, items []string, schema, mode string) (string, *http.Response, error) {
 	tr := &http.Transport{
 		MaxIdleConns:       1,
 		IdleConnTimeout:    30 * time.Second,
@@ -49,21 +88,19 @@ func (ig *IGMarkets) OpenLightStreamerSubscription(ctx context.Context, epics []
 
 	sessionID, sessionMsg, err := ig.lightStreamerConnect(c, sessionVersion2)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	if err := ig.lightStreamerSubscribe(c, sessionVersion2.LightstreamerEndpoint, sessionID, sessionMsg, epics); err != nil {
-		return err
+	if err := ig.lightStreamerSubscribe(c, sessionVersion2.LightstreamerEndpoint, sessionID, sessionMsg, items, schema, mode); err != nil {
+		return "", nil, err
 	}
 
 	httpStream, err := ig.lightStreamerBindToConnection(c, sessionVersion2.LightstreamerEndpoint, sessionID)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	go ig.lightstreamerReadSubscription(epics, tickReceiver, httpStream)
-
-	return nil
+	return sessionID, httpStream, nil
 }
 
 // connectToLightStream - Create new lightstreamer session
@@ -97,15 +134,13 @@ func (ig *IGMarkets) lightStreamerConnect(client *http.Client, sessionVersion2 *
 	return sessionID, sessionMsg, nil
 }
 
-// lightStreamerSubscribe - Adding subscription for epics
-func (ig *IGMarkets) lightStreamerSubscribe(client *http.Client, lightStreamerEndpoint, sessionID, sessionMsg string, epics []string) error {
-	var epicList string
-	for _, epic := range epics {
-		epicList = epicList + "MARKET:" + epic + "+"
-	}
+// lightStreamerSubscribe - Adding subscription for items, e.g. "MARKET:CS.D.BITCOIN.CFD.IP"
+// schema: fields separated by "+"
+func (ig *IGMarkets) lightStreamerSubscribe(client *http.Client, lightStreamerEndpoint, sessionID, sessionMsg string,
+	items []string, schema, mode string) error {
 	body := []byte("LS_session=" + sessionID +
 		"&LS_polling=true&LS_polling_millis=0&LS_idle_millis=0&LS_op=add&LS_Table=1&LS_id=" +
-		epicList + "&LS_schema=UPDATE_TIME+BID+OFFER+MARKET_STATE&LS_mode=MERGE")
+		strings.Join(items, "+") + "&LS_schema=" + schema + "&LS_mode=" + mode)
 	bodyBuf := bytes.NewBuffer(body)
 	url := fmt.Sprintf("%s/lightstreamer/control.txt", lightStreamerEndpoint)
 	resp, err := client.Post(url, lightStreamerContentType, bodyBuf)
@@ -148,12 +183,13 @@ func (ig *IGMarkets) lightStreamerBindToConnection(client *http.Client, lightStr
 	return resp, nil
 }
 
-func (ig *IGMarkets) lightstreamerReadSubscription(epics []string, tickReceiver chan LightStreamerTick, resp *http.Response) {
+func (ig *IGMarkets) lightstreamerReadSubscription(sessionID string, epics []string, tickReceiver chan LightStreamerTick, resp *http.Response) {
 	const epicNameUnknown = "unknown"
-	var respBuf = make([]byte, 64)
 	var lastTicks = make(map[string]LightStreamerTick, len(epics)) // epic -> tick
 
 	defer close(tickReceiver)
+	defer ig.observeStreamDisconnect() // Before closing the receiver, which may trigger a reconnect
+	defer ig.closeBody(resp.Body)
 
 	// map table index -> epic name
 	var epicIndex = make(map[string]string, len(epics))
@@ -161,30 +197,48 @@ func (ig *IGMarkets) lightstreamerReadSubscription(epics []string, tickReceiver
 		epicIndex[fmt.Sprintf("1,%d", i+1)] = epic
 	}
 
+	// Every message is terminated by CRLF
+	reader := bufio.NewReader(resp.Body)
 	for {
-		read, err := resp.Body.Read(respBuf)
+		line, err := reader.ReadString('\n')
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			fmt.Printf("reading lightstreamer subscription failed: %v", err)
+			ig.log(logLevelError, "reading lightstreamer subscription failed", "sessionID", sessionID, "error", err)
 			break
 		}
 
-		priceMsg := string(respBuf[0:read])
-		priceParts := strings.Split(priceMsg, "|")
+		priceMsg := strings.TrimRight(line, "\r\n")
 
 		// Sever ends streaming
-		if priceMsg == "LOOP\r\n\r\n" {
-			fmt.Printf("ending\n")
+		if priceMsg == "LOOP" || priceMsg == "END" || strings.HasPrefix(priceMsg, "END ") {
+			ig.log(logLevelInfo, "lightstreamer server ended stream", "sessionID", sessionID, "message", priceMsg)
 			break
 		}
 
+		priceParts := strings.Split(priceMsg, "|")
+		if len(priceParts) == 1 {
+			// PROBE, empty lines and session details
+			continue
+		}
 		if len(priceParts) != 5 {
-			//fmt.Printf("Malformed price message: %q\n", priceMsg)
+			epic, found := epicIndex[priceParts[0]]
+			if !found {
+				epic = epicNameUnknown
+			}
+			ig.log(logLevelWarn, "malformed lightstreamer update", "sessionID", sessionID, "epic", epic, "message", priceMsg)
+			ig.observeTick(epic, true)
 			continue
 		}
 
+		tableIndex := priceParts[0]
+		epic, found := epicIndex[tableIndex]
+		if !found {
+			ig.log(logLevelWarn, "unknown epic", "sessionID", sessionID, "tableIndex", tableIndex)
+			epic = epicNameUnknown
+		}
+
 		var parsedTime time.Time
 		if priceParts[1] != "" {
 			priceTime := priceParts[1]
@@ -192,27 +246,21 @@ func (ig *IGMarkets) lightstreamerReadSubscription(epics []string, tickReceiver
 			parsedTime, err = time.ParseInLocation("2006-1-2 15:04:05", fmt.Sprintf("%d-%d-%d %s",
 				now.Year(), now.Month(), now.Day(), priceTime), ig.TimeZoneLightStreamer)
 			if err != nil {
-				fmt.Printf("parsing time failed: %v time=%q\n", err, priceTime)
+				ig.log(logLevelWarn, "parsing time failed", "sessionID", sessionID, "epic", epic, "time", priceTime, "error", err)
+				ig.observeTick(epic, true)
 				continue
 			}
 		}
-		tableIndex := priceParts[0]
-		priceBid, _ := strconv.ParseFloat(priceParts[2], 64)
-		priceAsk, _ := strconv.ParseFloat(priceParts[3], 64)
-
-		epic, found := epicIndex[tableIndex]
-		if !found {
-			fmt.Printf("unknown epic %q\n", tableIndex)
-			epic = epicNameUnknown
-		}
+		priceBid, _ := ParseDecimal(priceParts[2])
+		priceAsk, _ := ParseDecimal(priceParts[3])
 
 		if epic != epicNameUnknown {
 			var lastTick, found = lastTicks[epic]
 			if found {
-				if priceAsk == 0 {
+				if priceAsk.IsZero() {
 					priceAsk = lastTick.Ask
 				}
-				if priceBid == 0 {
+				if priceBid.IsZero() {
 					priceBid = lastTick.Bid
 				}
 				if parsedTime.IsZero() {
@@ -227,7 +275,51 @@ func (ig *IGMarkets) lightstreamerReadSubscription(epics []string, tickReceiver
 			Bid:  priceBid,
 			Ask:  priceAsk,
 		}
+		if ig.dealer != nil && epic != epicNameUnknown {
+			ig.dealer.OnTick(tick)
+		}
 		tickReceiver <- tick
 		lastTicks[epic] = tick
+		ig.observeTick(epic, false)
+	}
+}
+
+func (ig *IGMarkets) lightstreamerReadTradeSubscription(sessionID string, confirmReceiver chan OTCDealConfirmation, resp *http.Response) {
+	if confirmReceiver != nil {
+		defer close(confirmReceiver)
+	}
+	defer ig.closeBody(resp.Body)
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				ig.log(logLevelError, "reading lightstreamer trade subscription failed", "sessionID", sessionID, "error", err)
+			}
+			break
+		}
+
+		msg := strings.TrimRight(line, "\r\n")
+		if msg == "LOOP" || msg == "END" || strings.HasPrefix(msg, "END ") {
+			ig.log(logLevelInfo, "lightstreamer server ended stream", "sessionID", sessionID, "message", msg)
+			break
+		}
+
+		// "1,1|{...}", empty values are unchanged and "#" is null
+		parts := strings.SplitN(msg, "|", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "{") {
+			continue
+		}
+		var confirm OTCDealConfirmation
+		if err := json.Unmarshal([]byte(parts[1]), &confirm); err != nil {
+			ig.log(logLevelWarn, "parsing trade confirmation failed", "sessionID", sessionID, "error", err)
+			continue
+		}
+
+		ig.confirms.deliver(confirm)
+		if confirmReceiver != nil {
+			confirmReceiver <- confirm
+		}
 	}
 }
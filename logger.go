@@ -0,0 +1,182 @@
+package igmarkets
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"log/slog"
+	"strings"
+)
+
+// Logger - Receives diagnostic messages of the client with alternating key-value pairs,
+// e.g. "epic", "CS.D.EURUSD.CFD.IP". Credentials and tokens are redacted before they reach the logger.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+type logLevel int
+
+const (
+	logLevelDebug logLevel = iota
+	logLevelInfo
+	logLevelWarn
+	logLevelError
+)
+
+// nopLogger - Default logger discarding all messages
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// slogLogger - Logger writing to log/slog
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger - Logger writing to the given slog.Logger, e.g. slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+func (l slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+func (l slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
+
+// logrusLogger - Logger writing to logrus
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+// NewLogrusLogger - Logger writing to the given logrus logger or entry, e.g. logrus.StandardLogger()
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	return logrusLogger{logger: logger}
+}
+
+func (l logrusLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(logrusFields(keysAndValues)).Debug(msg)
+}
+
+func (l logrusLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(logrusFields(keysAndValues)).Info(msg)
+}
+
+func (l logrusLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(logrusFields(keysAndValues)).Warn(msg)
+}
+
+func (l logrusLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(logrusFields(keysAndValues)).Error(msg)
+}
+
+func logrusFields(keysAndValues []interface{}) logrus.Fields {
+	fields := make(logrus.Fields, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fields["!BADKEY"] = keysAndValues[i]
+			break
+		}
+		fields[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+	}
+	return fields
+}
+
+// isSensitiveKey - Whether values logged with this key are always redacted
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range []string{"password", "token", "secret", "apikey", "api_key", "authorization", "cst"} {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// secrets - Credentials and tokens of the client that must never be logged
+func (ig *IGMarkets) secrets() []string {
+	ig.RLock()
+	defer ig.RUnlock()
+
+	var secrets []string
+	for _, secret := range []string{ig.APIKey, ig.Password, ig.OAuthToken.AccessToken,
+		ig.OAuthToken.RefreshToken, ig.CSTToken, ig.XSTToken} {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// redact - Replace secrets in the message and in string and error values
+func redact(secrets []string, msg string, keysAndValues []interface{}) (string, []interface{}) {
+	replace := func(s string) (string, bool) {
+		var replaced bool
+		for _, secret := range secrets {
+			if strings.Contains(s, secret) {
+				s = strings.ReplaceAll(s, secret, redacted)
+				replaced = true
+			}
+		}
+		return s, replaced
+	}
+
+	msg, _ = replace(msg)
+	redactedKeysAndValues := make([]interface{}, len(keysAndValues))
+	for i, value := range keysAndValues {
+		if i%2 == 1 {
+			if key, ok := keysAndValues[i-1].(string); ok && isSensitiveKey(key) {
+				redactedKeysAndValues[i] = redacted
+				continue
+			}
+		}
+		switch v := value.(type) {
+		case string:
+			value, _ = replace(v)
+		case error:
+			if s, replaced := replace(v.Error()); replaced {
+				value = s
+			}
+		case fmt.Stringer:
+			if s, replaced := replace(v.String()); replaced {
+				value = s
+			}
+		}
+		redactedKeysAndValues[i] = value
+	}
+	return msg, redactedKeysAndValues
+}
+
+// log - Write redacted message to the configured logger
+func (ig *IGMarkets) log(level logLevel, msg string, keysAndValues ...interface{}) {
+	if ig.logger == nil {
+		return
+	}
+
+	msg, keysAndValues = redact(ig.secrets(), msg, keysAndValues)
+	switch level {
+	case logLevelDebug:
+		ig.logger.Debug(msg, keysAndValues...)
+	case logLevelInfo:
+		ig.logger.Info(msg, keysAndValues...)
+	case logLevelWarn:
+		ig.logger.Warn(msg, keysAndValues...)
+	default:
+		ig.logger.Error(msg, keysAndValues...)
+	}
+}
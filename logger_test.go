@@ -0,0 +1,51 @@
+package igmarkets
+
+import (
+	"bytes"
+	"errors"
+	"github.com/AMekss/assert"
+	"github.com/sirupsen/logrus"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLoggerRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	igm, err := NewWithOptions(WithCredentials("KEY", "user", "secret"), WithLogger(NewSlogLogger(logger)))
+	assert.NoError(t, err)
+	igm.OAuthToken.AccessToken = "TOKEN"
+
+	igm.log(logLevelWarn, "login failed for secret", "endpoint", "/gateway/deal/session",
+		"error", errors.New("invalid token TOKEN"), "password", "other")
+
+	line := buf.String()
+	assert.True(t, strings.Contains(line, `"level":"WARN"`))
+	assert.True(t, strings.Contains(line, `"endpoint":"/gateway/deal/session"`))
+	assert.True(t, strings.Contains(line, `"msg":"login failed for [REDACTED]"`))
+	assert.True(t, strings.Contains(line, `"error":"invalid token [REDACTED]"`))
+	assert.True(t, strings.Contains(line, `"password":"[REDACTED]"`))
+	assert.False(t, strings.Contains(line, "TOKEN"))
+	assert.False(t, strings.Contains(line, "other"))
+}
+
+func TestLogrusLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	igm, err := NewWithOptions(WithLogger(NewLogrusLogger(logger)))
+	assert.NoError(t, err)
+
+	igm.log(logLevelDebug, "filtered by logrus level")
+	igm.log(logLevelError, "reading stream failed", "sessionID", "S1", "dangling")
+
+	line := buf.String()
+	assert.False(t, strings.Contains(line, "filtered"))
+	assert.True(t, strings.Contains(line, `"level":"error"`))
+	assert.True(t, strings.Contains(line, `"sessionID":"S1"`))
+	assert.True(t, strings.Contains(line, `"!BADKEY":"dangling"`))
+}
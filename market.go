@@ -9,19 +9,19 @@ import (
 
 // MarketData - Subset of OTCWorkingOrder
 type MarketData struct {
-	Bid                      float64 `json:"bid"`
+	Bid                      Decimal `json:"bid"`
 	DelayTime                int     `json:"delayTime"`
 	Epic                     string  `json:"epic"`
 	ExchangeID               string  `json:"exchangeId"`
 	Expiry                   string  `json:"expiry"`
-	High                     float64 `json:"high"`
+	High                     Decimal `json:"high"`
 	InstrumentName           string  `json:"instrumentName"`
 	InstrumentType           string  `json:"instrumentType"`
-	LotSize                  float64 `json:"lotSize"`
-	Low                      float64 `json:"low"`
+	LotSize                  Decimal `json:"lotSize"`
+	Low                      Decimal `json:"low"`
 	MarketStatus             string  `json:"marketStatus"`
-	NetChange                float64 `json:"netChange"`
-	Offer                    float64 `json:"offer"`
+	NetChange                Decimal `json:"netChange"`
+	Offer                    Decimal `json:"offer"`
 	PercentageChange         float64 `json:"percentageChange"`
 	ScalingFactor            int     `json:"scalingFactor"`
 	StreamingPricesAvailable bool    `json:"streamingPricesAvailable"`
@@ -64,7 +64,7 @@ type Currency struct {
 // UnitValueFloat - Part of MarketsResponse
 type UnitValueFloat struct {
 	Unit  string  `json:"unit"`
-	Value float64 `json:"value"`
+	Value Decimal `json:"value"`
 }
 
 // Instrument - Part of MarketsResponse
@@ -80,7 +80,7 @@ type Instrument struct {
 	Unit                     string         `json:"unit"`
 	Type                     string         `json:"type"`
 	MarketID                 string         `json:"marketID"`
-	LotSize                  float64        `json:"lotSize"`
+	LotSize                  Decimal        `json:"lotSize"`
 	MarginFactor             float64        `json:"marginFactor"`
 	MarginFactorUnit         string         `json:"marginFactorUnit"`
 	SlippageFactor           UnitValueFloat `json:"slippageFactor"`
@@ -95,17 +95,17 @@ type Instrument struct {
 // Snapshot - Part of MarketsResponse
 type Snapshot struct {
 	MarketStatus              string  `json:"marketStatus"`
-	NetChange                 float64 `json:"netChange"`
+	NetChange                 Decimal `json:"netChange"`
 	PercentageChange          float64 `json:"percentageChange"`
 	UpdateTime                string  `json:"updateTime"`
 	DelayTime                 float64 `json:"delayTime"`
-	Bid                       float64 `json:"bid"`
-	Offer                     float64 `json:"offer"`
-	High                      float64 `json:"high"`
-	Low                       float64 `json:"low"`
+	Bid                       Decimal `json:"bid"`
+	Offer                     Decimal `json:"offer"`
+	High                      Decimal `json:"high"`
+	Low                       Decimal `json:"low"`
 	DecimalPlacesFactor       float64 `json:"decimalPlacesFactor"`
 	ScalingFactor             float64 `json:"scalingFactor"`
-	ControlledRiskExtraSpread float64 `json:"controlledRiskExtraSpread"`
+	ControlledRiskExtraSpread Decimal `json:"controlledRiskExtraSpread"`
 }
 
 // MarketSearch - Search for ISIN or share names to get the epic.
@@ -119,11 +119,10 @@ func (ig *IGMarkets) MarketSearch(ctx context.Context, term string) (*MarketSear
 		return nil, fmt.Errorf("igmarkets: unable to get markets data: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, MarketSearchResponse{})
+	igResponse, err := do[MarketSearchResponse](ctx, ig, req, 1)
 	if err != nil {
 		return nil, err
 	}
-	igResponse, _ := igResponseInterface.(*MarketSearchResponse)
 
 	return igResponse, err
 }
@@ -138,11 +137,10 @@ func (ig *IGMarkets) GetMarkets(ctx context.Context, epic string) (*MarketsRespo
 		return nil, fmt.Errorf("igmarkets: unable to get markets data: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 3, MarketsResponse{})
+	igResponse, err := do[MarketsResponse](ctx, ig, req, 3)
 	if err != nil {
 		return nil, err
 	}
-	igResponse, _ := igResponseInterface.(*MarketsResponse)
 
 	return igResponse, err
 }
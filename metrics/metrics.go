@@ -0,0 +1,151 @@
+// Package metrics exports Prometheus metrics of igmarkets clients: REST request latency by endpoint,
+// allowance limit hits, session events and Lightstreamer tick throughput.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sklinkert/igmarkets"
+	"strconv"
+	"sync"
+)
+
+const namespace = "igmarkets"
+
+// Metrics - Prometheus collectors shared by any number of clients
+type Metrics struct {
+	requestDuration   *prometheus.HistogramVec
+	allowanceExceeded *prometheus.CounterVec
+	sessionEvents     *prometheus.CounterVec
+	ticksReceived     *prometheus.CounterVec
+	ticksDropped      *prometheus.CounterVec
+	streamConnects    prometheus.Counter
+	streamReconnects  prometheus.Counter
+
+	mu           sync.Mutex
+	streamsEnded int // Ended streams of any client that were not followed by a connect yet
+}
+
+// New - Create collectors and register them with the given registerer, e.g. prometheus.DefaultRegisterer
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of REST request attempts by endpoint, endpoint version and HTTP status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "endpoint", "version", "status"}),
+		allowanceExceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "allowance_exceeded_total",
+			Help:      "REST requests rejected because an API allowance was exceeded, by IG error code.",
+		}, []string{"error_code"}),
+		sessionEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "session_events_total",
+			Help:      "Logins, token refreshes and their failures.",
+		}, []string{"state"}),
+		ticksReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_ticks_received_total",
+			Help:      "Ticks received from the Lightstreamer stream by epic.",
+		}, []string{"epic"}),
+		ticksDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_ticks_dropped_total",
+			Help:      "Lightstreamer updates dropped because they could not be parsed, by epic.",
+		}, []string{"epic"}),
+		streamConnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_connects_total",
+			Help:      "Successful Lightstreamer subscriptions.",
+		}),
+		streamReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_reconnects_total",
+			Help:      "Lightstreamer subscriptions opened after a stream ended, also by a new client.",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.requestDuration, m.allowanceExceeded, m.sessionEvents,
+		m.ticksReceived, m.ticksDropped, m.streamConnects, m.streamReconnects} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("metrics: unable to register collector: %v", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Option - Instrument a client created by igmarkets.NewWithOptions()
+func (m *Metrics) Option() igmarkets.Option {
+	return func(ig *igmarkets.IGMarkets) error {
+		ig.Use(m.Middleware())
+		return igmarkets.WithObserver(m)(ig)
+	}
+}
+
+// Middleware - Record duration and allowance errors of every REST request attempt
+func (m *Metrics) Middleware() igmarkets.Middleware {
+	return func(next igmarkets.Handler) igmarkets.Handler {
+		return func(ctx context.Context, req *igmarkets.Request) (*igmarkets.Response, error) {
+			resp, err := next(ctx, req)
+
+			status := "error"
+			if resp != nil && resp.StatusCode != 0 {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			if resp != nil {
+				m.requestDuration.WithLabelValues(req.Method, req.Endpoint(), strconv.Itoa(req.Version), status).
+					Observe(resp.Duration.Seconds())
+			}
+
+			var apiErr *igmarkets.APIError
+			if errors.As(err, &apiErr) && (errors.Is(err, igmarkets.ErrRateLimited) ||
+				errors.Is(err, igmarkets.ErrHistoricalDataAllowanceExceeded)) {
+				m.allowanceExceeded.WithLabelValues(apiErr.ErrorCode).Inc()
+			}
+
+			return resp, err
+		}
+	}
+}
+
+// ObserveSession - Implements igmarkets.Observer
+func (m *Metrics) ObserveSession(event igmarkets.SessionEvent) {
+	m.sessionEvents.WithLabelValues(event.State.String()).Inc()
+}
+
+// ObserveTick - Implements igmarkets.Observer
+func (m *Metrics) ObserveTick(epic string, dropped bool) {
+	if dropped {
+		m.ticksDropped.WithLabelValues(epic).Inc()
+		return
+	}
+	m.ticksReceived.WithLabelValues(epic).Inc()
+}
+
+// ObserveStreamConnect - Implements igmarkets.Observer. A connect following an ended stream of any
+// instrumented client is a reconnect, so clients created for every reconnect are counted as well.
+func (m *Metrics) ObserveStreamConnect(reconnect bool) {
+	m.mu.Lock()
+	if m.streamsEnded > 0 {
+		m.streamsEnded--
+		reconnect = true
+	}
+	m.mu.Unlock()
+
+	m.streamConnects.Inc()
+	if reconnect {
+		m.streamReconnects.Inc()
+	}
+}
+
+// ObserveStreamDisconnect - Implements igmarkets.Observer
+func (m *Metrics) ObserveStreamDisconnect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streamsEnded++
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"github.com/AMekss/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sklinkert/igmarkets"
+	"github.com/sklinkert/igmarkets/igtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gateway/deal/session":
+			_, _ = w.Write([]byte(`{"oauthToken":{"access_token":"TOKEN","refresh_token":"REFRESH","expires_in":"60"}}`))
+		case "/gateway/deal/markets/CS.D.EURUSD.CFD.IP":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errorCode":"error.public-api.exceeded-account-allowance"}`))
+		default:
+			_, _ = w.Write([]byte(`{"trailingStopsEnabled":true}`))
+		}
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	m, err := New(registry)
+	assert.NoError(t, err)
+
+	igm, err := igmarkets.NewWithOptions(igmarkets.WithBaseURL(server.URL), m.Option())
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, igm.Login(ctx))
+	_, err = igm.GetAccountPreferences(ctx)
+	assert.NoError(t, err)
+	_, err = igm.GetMarkets(ctx, "CS.D.EURUSD.CFD.IP")
+	assert.True(t, err != nil)
+
+	assert.EqualInt(t, 3, testutil.CollectAndCount(m.requestDuration))
+	var histogram dto.Metric
+	observer := m.requestDuration.WithLabelValues("GET", "/gateway/deal/markets/{id}", "3", "403")
+	assert.NoError(t, observer.(prometheus.Histogram).Write(&histogram))
+	assert.EqualInt(t, 1, int(histogram.GetHistogram().GetSampleCount()))
+	assert.EqualFloat64(t, 1, testutil.ToFloat64(m.allowanceExceeded.WithLabelValues("error.public-api.exceeded-account-allowance")))
+	assert.EqualFloat64(t, 1, testutil.ToFloat64(m.sessionEvents.WithLabelValues("logged_in")))
+
+	m.ObserveTick("CS.D.EURUSD.CFD.IP", false)
+	m.ObserveTick("CS.D.EURUSD.CFD.IP", true)
+	m.ObserveStreamConnect(true)
+	assert.EqualFloat64(t, 1, testutil.ToFloat64(m.ticksReceived.WithLabelValues("CS.D.EURUSD.CFD.IP")))
+	assert.EqualFloat64(t, 1, testutil.ToFloat64(m.ticksDropped.WithLabelValues("CS.D.EURUSD.CFD.IP")))
+	assert.EqualFloat64(t, 1, testutil.ToFloat64(m.streamReconnects))
+
+	// Registering twice fails
+	_, err = New(registry)
+	assert.True(t, err != nil)
+}
+
+func TestStreamMetrics(t *testing.T) {
+	server := igtest.NewServer(t)
+	lightstreamer := igtest.NewLightstreamerServer(t)
+	server.SetLightstreamerEndpoint(lightstreamer.URL)
+
+	m, err := New(prometheus.NewRegistry())
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// Like examples/lightstreamer, every reconnect uses a new client
+	for i := 0; i < 2; i++ {
+		igm, err := server.Client(m.Option())
+		assert.NoError(t, err)
+		ticks := make(chan igmarkets.LightStreamerTick)
+		assert.NoError(t, igm.OpenLightStreamerSubscription(ctx, []string{"CS.D.EURUSD.CFD.IP"}, ticks))
+		assert.NoError(t, lightstreamer.Push("1,1|garbage"))
+		assert.NoError(t, lightstreamer.PushLoop())
+		for range ticks {
+		}
+	}
+
+	assert.EqualFloat64(t, 2, testutil.ToFloat64(m.streamConnects))
+	assert.EqualFloat64(t, 1, testutil.ToFloat64(m.streamReconnects))
+	assert.EqualFloat64(t, 2, testutil.ToFloat64(m.ticksDropped.WithLabelValues("CS.D.EURUSD.CFD.IP")))
+}
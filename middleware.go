@@ -0,0 +1,123 @@
+package igmarkets
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Request - Single attempt of a REST request as seen by a Middleware
+type Request struct {
+	Method      string        // HTTP method as sent, see the _method header for DELETE via POST
+	Path        string        // e.g. /gateway/deal/positions/otc
+	Version     int           // Value of the VERSION header
+	HTTPRequest *http.Request // Headers may be changed by middlewares
+}
+
+// staticPathSegments - Path segments kept by Endpoint(), all others are IDs (epics, deal IDs, ...)
+var staticPathSegments = map[string]bool{
+	"gateway": true, "deal": true, "accounts": true, "preferences": true, "history": true,
+	"activity": true, "transactions": true, "session": true, "encryptionKey": true,
+	"refresh-token": true, "markets": true, "marketnavigation": true, "prices": true,
+	"positions": true, "otc": true, "workingorders": true, "watchlists": true,
+	"clientsentiment": true, "related": true, "confirms": true, "operations": true, "application": true,
+}
+
+// Endpoint - Path with IDs replaced by placeholders, e.g. /gateway/deal/markets/{id}
+// for /gateway/deal/markets/CS.D.EURUSD.CFD.IP. Suited as low cardinality metric label or span name.
+func (r *Request) Endpoint() string {
+	segments := strings.Split(strings.Trim(r.Path, "/"), "/")
+	for i, segment := range segments {
+		if !staticPathSegments[segment] {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Response - Result of a single attempt of a REST request as seen by a Middleware
+type Response struct {
+	StatusCode   int           // 0 if no response was received
+	Header       http.Header   // nil if no response was received
+	Body         io.ReadCloser // Body of a successful response, decoded by the client; nil on error
+	Duration     time.Duration // Latency of the attempt including reading the body of error responses
+	HTTPResponse *http.Response
+}
+
+// Handler - Sends a request once. Error responses are returned as *APIError together with
+// the Response, transport errors with a Response without status code.
+type Handler func(ctx context.Context, req *Request) (*Response, error)
+
+// Middleware - Wraps a Handler to observe or alter requests, e.g. for logging, auditing, metrics or
+// fault injection. A middleware may return without calling next; returning an *APIError is then
+// treated like the error response of IG, including retries.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware - Add middlewares to the client, see Use()
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(ig *IGMarkets) error {
+		ig.Use(middlewares...)
+		return nil
+	}
+}
+
+// Use - Add middlewares wrapping every attempt of a REST request, including retries and re-sent requests
+// after re-authentication. The first middleware added is the outermost one.
+func (ig *IGMarkets) Use(middlewares ...Middleware) {
+	ig.Lock()
+	defer ig.Unlock()
+
+	for _, middleware := range middlewares {
+		if middleware != nil {
+			ig.middlewares = append(ig.middlewares, middleware)
+		}
+	}
+}
+
+// handler - Core handler wrapped by all middlewares
+func (ig *IGMarkets) handler() Handler {
+	ig.RLock()
+	middlewares := ig.middlewares
+	ig.RUnlock()
+
+	handler := ig.roundTrip
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// roundTrip - Send the request once. The body of a successful response is left open for decoding,
+// the body of an error response is read into APIError.
+func (ig *IGMarkets) roundTrip(_ context.Context, req *Request) (*Response, error) {
+	start := time.Now()
+	httpResp, err := ig.httpClient.Do(req.HTTPRequest)
+	if err != nil {
+		return &Response{Duration: time.Since(start)}, fmt.Errorf("igmarkets: unable to send HTTP request: %w", err)
+	}
+
+	resp := &Response{
+		StatusCode:   httpResp.StatusCode,
+		Header:       httpResp.Header,
+		HTTPResponse: httpResp,
+	}
+
+	// DELETE /session answers with 204 No Content
+	if httpResp.StatusCode >= http.StatusOK && httpResp.StatusCode < http.StatusMultipleChoices {
+		resp.Body = httpResp.Body
+		resp.Duration = time.Since(start)
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	ig.closeBody(httpResp.Body)
+	resp.Duration = time.Since(start)
+	if err != nil {
+		return resp, fmt.Errorf("igmarkets: unable to read body of HTTP status %d response: %w", httpResp.StatusCode, err)
+	}
+	return resp, newAPIError(req.Method, req.Path, req.Version, httpResp, body)
+}
@@ -0,0 +1,91 @@
+package igmarkets
+
+import (
+	"context"
+	"errors"
+	"github.com/AMekss/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Audit") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/gateway/deal/positions/" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errorCode":"error.service.marketdata.position.details.null.error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"trailingStopsEnabled":true}`))
+	}))
+	defer server.Close()
+
+	var order []string
+	var seen []*Request
+	var statusCodes []int
+	var apiErr *APIError
+	audit := func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			order = append(order, "audit")
+			req.HTTPRequest.Header.Set("X-Audit", "1")
+			resp, err := next(ctx, req)
+			seen = append(seen, req)
+			statusCodes = append(statusCodes, resp.StatusCode)
+			errors.As(err, &apiErr)
+			return resp, err
+		}
+	}
+	inner := func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			order = append(order, "inner")
+			return next(ctx, req)
+		}
+	}
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithMiddleware(audit, inner))
+	assert.NoError(t, err)
+
+	_, err = igm.GetAccountPreferences(context.Background())
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "audit", order[0])
+	assert.EqualStrings(t, "inner", order[1])
+	assert.EqualStrings(t, "GET", seen[0].Method)
+	assert.EqualStrings(t, "/gateway/deal/accounts/preferences", seen[0].Path)
+	assert.EqualInt(t, 1, seen[0].Version)
+	assert.EqualInt(t, http.StatusOK, statusCodes[0])
+
+	_, err = igm.GetPositions(context.Background())
+	assert.True(t, err != nil)
+	assert.EqualInt(t, 2, seen[1].Version)
+	assert.EqualInt(t, http.StatusNotFound, statusCodes[1])
+	assert.EqualStrings(t, "error.service.marketdata.position.details.null.error", apiErr.ErrorCode)
+
+	// Fault injection: fail the first attempt without sending it
+	var attempts int
+	igm.RetryPolicy = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	igm.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			attempts++
+			if attempts == 1 {
+				return &Response{StatusCode: http.StatusServiceUnavailable},
+					&APIError{StatusCode: http.StatusServiceUnavailable, Method: req.Method, Endpoint: req.Path}
+			}
+			return next(ctx, req)
+		}
+	})
+	preferences, err := igm.GetAccountPreferences(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, preferences.TrailingStopsEnabled)
+	assert.EqualInt(t, 2, attempts)
+}
+
+func TestRequestEndpoint(t *testing.T) {
+	assert.EqualStrings(t, "/gateway/deal/positions", (&Request{Path: "/gateway/deal/positions/"}).Endpoint())
+	assert.EqualStrings(t, "/gateway/deal/watchlists/{id}/{id}", (&Request{Path: "/gateway/deal/watchlists/123/CS.D.EURUSD.CFD.IP"}).Endpoint())
+	assert.EqualStrings(t, "/gateway/deal/session/refresh-token", (&Request{Path: "/gateway/deal/session/refresh-token"}).Endpoint())
+}
@@ -0,0 +1,60 @@
+package igmarkets
+
+// Observer - Receives events of the client that are not visible to a Middleware, e.g. for metrics.
+// Methods are called synchronously from request and stream goroutines and must not block.
+type Observer interface {
+	// ObserveSession - Called for every session state change, whether KeepSession() is running or not
+	ObserveSession(event SessionEvent)
+	// ObserveTick - Called for every tick read from the Lightstreamer stream. dropped is true if the
+	// update could not be parsed and was not sent to the tick receiver.
+	ObserveTick(epic string, dropped bool)
+	// ObserveStreamConnect - Called when OpenLightStreamerSubscription() connected, reconnect is true
+	// if a stream of the same client ended before
+	ObserveStreamConnect(reconnect bool)
+	// ObserveStreamDisconnect - Called when the stream of OpenLightStreamerSubscription() ended, e.g. after LOOP
+	// or a dropped connection. Observers shared by clients that are created for every reconnect can count the
+	// next ObserveStreamConnect() as a reconnect.
+	ObserveStreamDisconnect()
+}
+
+// WithObserver - Add an observer to the client, see Observer
+func WithObserver(observer Observer) Option {
+	return func(ig *IGMarkets) error {
+		if observer != nil {
+			ig.observers = append(ig.observers, observer)
+		}
+		return nil
+	}
+}
+
+func (ig *IGMarkets) observeSession(event SessionEvent) {
+	for _, observer := range ig.observers {
+		observer.ObserveSession(event)
+	}
+}
+
+func (ig *IGMarkets) observeTick(epic string, dropped bool) {
+	for _, observer := range ig.observers {
+		observer.ObserveTick(epic, dropped)
+	}
+}
+
+func (ig *IGMarkets) observeStreamConnect() {
+	ig.RLock()
+	reconnect := ig.streamsEnded > 0
+	ig.RUnlock()
+
+	for _, observer := range ig.observers {
+		observer.ObserveStreamConnect(reconnect)
+	}
+}
+
+func (ig *IGMarkets) observeStreamDisconnect() {
+	ig.Lock()
+	ig.streamsEnded++
+	ig.Unlock()
+
+	for _, observer := range ig.observers {
+		observer.ObserveStreamDisconnect()
+	}
+}
@@ -0,0 +1,139 @@
+package igmarkets
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option - Configures an IGMarkets instance created by NewWithOptions()
+type Option func(ig *IGMarkets) error
+
+// NewWithOptions - Create new instance of igmarkets. Uses DemoAPIURL unless WithBaseURL() is given.
+func NewWithOptions(opts ...Option) (*IGMarkets, error) {
+	ig := &IGMarkets{
+		APIURL: DemoAPIURL,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 5,
+			},
+		},
+		logger: nopLogger{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(ig); err != nil {
+			return nil, err
+		}
+	}
+
+	// Applied last so it works regardless of the order of WithHTTPClient() and WithTimeout()
+	if ig.timeout > 0 {
+		httpClient := *ig.httpClient
+		httpClient.Timeout = ig.timeout
+		ig.httpClient = &httpClient
+	}
+
+	return ig, nil
+}
+
+// WithBaseURL - Use the given API URL, e.g. DemoAPIURL, LiveAPIURL or the URL of a local test server
+func WithBaseURL(apiURL string) Option {
+	return func(ig *IGMarkets) error {
+		u, err := url.Parse(apiURL)
+		if err != nil {
+			return fmt.Errorf("igmarkets: invalid base URL %q: %v", apiURL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("igmarkets: invalid base URL %q: scheme and host required", apiURL)
+		}
+		ig.APIURL = strings.TrimRight(apiURL, "/")
+		return nil
+	}
+}
+
+// WithCredentials - Set API key, identifier (username) and password used by Login()
+func WithCredentials(apiKey, identifier, password string) Option {
+	return func(ig *IGMarkets) error {
+		ig.APIKey = apiKey
+		ig.Identifier = identifier
+		ig.Password = password
+		return nil
+	}
+}
+
+// WithEncryptedPassword - Encrypt the password with IG's public key on login
+func WithEncryptedPassword() Option {
+	return func(ig *IGMarkets) error {
+		ig.EncryptPassword = true
+		return nil
+	}
+}
+
+// WithAccountID - Set the account ID sent with every request
+func WithAccountID(accountID string) Option {
+	return func(ig *IGMarkets) error {
+		ig.AccountID = accountID
+		return nil
+	}
+}
+
+// WithHTTPClient - Use the given HTTP client for all REST requests, e.g. for proxies or tests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(ig *IGMarkets) error {
+		if httpClient == nil {
+			return fmt.Errorf("igmarkets: HTTP client must not be nil")
+		}
+		ig.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithTimeout - Set timeout for each REST request
+func WithTimeout(timeout time.Duration) Option {
+	return func(ig *IGMarkets) error {
+		if timeout < 0 {
+			return fmt.Errorf("igmarkets: timeout must not be negative")
+		}
+		ig.timeout = timeout
+		return nil
+	}
+}
+
+// WithUserAgent - Send the given User-Agent header with every REST request
+func WithUserAgent(userAgent string) Option {
+	return func(ig *IGMarkets) error {
+		ig.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithLogger - Write diagnostic messages to the given logger, see NewSlogLogger() and NewLogrusLogger().
+// Messages are discarded by default.
+func WithLogger(logger Logger) Option {
+	return func(ig *IGMarkets) error {
+		if logger == nil {
+			return fmt.Errorf("igmarkets: logger must not be nil")
+		}
+		ig.logger = logger
+		return nil
+	}
+}
+
+// WithRetryPolicy - Retry failed requests according to the given policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(ig *IGMarkets) error {
+		ig.RetryPolicy = policy
+		return nil
+	}
+}
+
+// WithRateLimiter - Throttle requests on the client side, see NewRateLimiter()
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(ig *IGMarkets) error {
+		ig.RateLimiter = limiter
+		return nil
+	}
+}
@@ -10,15 +10,15 @@ import (
 
 // OTCPositionCloseRequest - request struct for closing positions
 type OTCPositionCloseRequest struct {
-	DealID      string  `json:"dealId,omitempty"`
-	Direction   string  `json:"direction"` // "BUY" or "SELL"
-	Epic        string  `json:"epic,omitempty"`
-	Expiry      string  `json:"expiry,omitempty"`
-	Level       string  `json:"level,omitempty"`
-	OrderType   string  `json:"orderType"`
-	QuoteID     string  `json:"quoteId,omitempty"`
-	Size        float64 `json:"size"`                  // Deal size
-	TimeInForce string  `json:"timeInForce,omitempty"` // "EXECUTE_AND_ELIMINATE" or "FILL_OR_KILL"
+	DealID      string      `json:"dealId,omitempty"`
+	Direction   Direction   `json:"direction"` // Opposite of the position's direction
+	Epic        string      `json:"epic,omitempty"`
+	Expiry      string      `json:"expiry,omitempty"`
+	Level       Decimal     `json:"level"`
+	OrderType   OrderType   `json:"orderType"`
+	QuoteID     string      `json:"quoteId,omitempty"`
+	Size        Decimal     `json:"size"`                  // Deal size
+	TimeInForce TimeInForce `json:"timeInForce,omitempty"` // TimeInForceExecuteAndEliminate or TimeInForceFillOrKill
 }
 
 // AffectedDeal - part of order confirmation
@@ -34,100 +34,113 @@ type DealReference struct {
 
 // OTCOrderRequest - request struct for placing orders
 type OTCOrderRequest struct {
-	Epic                  string  `json:"epic"`
-	Level                 string  `json:"level,omitempty"`
-	ForceOpen             bool    `json:"forceOpen"`
-	OrderType             string  `json:"orderType"`
-	CurrencyCode          string  `json:"currencyCode"`
-	Direction             string  `json:"direction"` // "BUY" or "SELL"
-	Expiry                string  `json:"expiry"`
-	Size                  float64 `json:"size"` // Deal size
-	StopDistance          string  `json:"stopDistance,omitempty"`
-	StopLevel             string  `json:"stopLevel,omitempty"`
-	LimitDistance         string  `json:"limitDistance,omitempty"`
-	LimitLevel            string  `json:"limitLevel,omitempty"`
-	QuoteID               string  `json:"quoteId,omitempty"`
-	TimeInForce           string  `json:"timeInForce,omitempty"` // "EXECUTE_AND_ELIMINATE" or "FILL_OR_KILL"
-	TrailingStop          bool    `json:"trailingStop"`
-	TrailingStopIncrement string  `json:"trailingStopIncrement,omitempty"`
-	GuaranteedStop        bool    `json:"guaranteedStop"`
-	DealReference         string  `json:"dealReference,omitempty"`
+	Epic                  string      `json:"epic"`
+	Level                 Decimal     `json:"level"`
+	ForceOpen             bool        `json:"forceOpen"`
+	OrderType             OrderType   `json:"orderType"`
+	CurrencyCode          string      `json:"currencyCode"`
+	Direction             Direction   `json:"direction"`
+	Expiry                string      `json:"expiry"`
+	Size                  Decimal     `json:"size"` // Deal size
+	StopDistance          Decimal     `json:"stopDistance"`
+	StopLevel             Decimal     `json:"stopLevel"`
+	LimitDistance         Decimal     `json:"limitDistance"`
+	LimitLevel            Decimal     `json:"limitLevel"`
+	QuoteID               string      `json:"quoteId,omitempty"`
+	TimeInForce           TimeInForce `json:"timeInForce,omitempty"` // TimeInForceExecuteAndEliminate or TimeInForceFillOrKill
+	TrailingStop          bool        `json:"trailingStop"`
+	TrailingStopIncrement Decimal     `json:"trailingStopIncrement"`
+	GuaranteedStop        bool        `json:"guaranteedStop"`
+	DealReference         string      `json:"dealReference,omitempty"`
 }
 
 // WorkingOrderData - Subset of OTCWorkingOrder
 type WorkingOrderData struct {
-	CreatedDate     string  `json:"createdDate"`
-	CreatedDateUTC  string  `json:"createdDateUTC"`
-	CurrencyCode    string  `json:"currencyCode"`
-	DealID          string  `json:"dealId"`
-	Direction       string  `json:"direction"` // "BUY" or "SELL"
-	DMA             bool    `json:"dma"`
-	Epic            string  `json:"epic"`
-	GoodTillDate    string  `json:"goodTillDate"`
-	GoodTillDateISO string  `json:"goodTillDateISO"`
-	GuaranteedStop  bool    `json:"guaranteedStop"`
-	LimitDistance   float64 `json:"limitDistance"`
-	OrderLevel      float64 `json:"orderLevel"`
-	OrderSize       float64 `json:"orderSize"` // Deal size
-	OrderType       string  `json:"orderType"`
-	StopDistance    float64 `json:"stopDistance"`
-	TimeInForce     string  `json:"timeInForce,omitempty"` // "EXECUTE_AND_ELIMINATE" or "FILL_OR_KILL"
+	CreatedDate     string           `json:"createdDate"`
+	CreatedDateUTC  string           `json:"createdDateUTC"`
+	CurrencyCode    string           `json:"currencyCode"`
+	DealID          string           `json:"dealId"`
+	Direction       Direction        `json:"direction"`
+	DMA             bool             `json:"dma"`
+	Epic            string           `json:"epic"`
+	GoodTillDate    string           `json:"goodTillDate"`
+	GoodTillDateISO string           `json:"goodTillDateISO"`
+	GuaranteedStop  bool             `json:"guaranteedStop"`
+	LimitDistance   Decimal          `json:"limitDistance"`
+	OrderLevel      Decimal          `json:"orderLevel"`
+	OrderSize       Decimal          `json:"orderSize"` // Deal size
+	OrderType       WorkingOrderType `json:"orderType"`
+	StopDistance    Decimal          `json:"stopDistance"`
+	TimeInForce     TimeInForce      `json:"timeInForce,omitempty"` // TimeInForceGoodTillCancelled or TimeInForceGoodTillDate
 }
 
 // OTCDealConfirmation - Deal confirmation
 type OTCDealConfirmation struct {
 	Epic                  string         `json:"epic"`
 	AffectedDeals         []AffectedDeal `json:"affectedDeals"`
-	Level                 float64        `json:"level"`
+	DealID                string         `json:"dealId"`
+	Level                 Decimal        `json:"level"`
 	ForceOpen             bool           `json:"forceOpen"`
-	DealStatus            string         `json:"dealStatus"`
-	Reason                string         `json:"reason"`
-	Status                string         `json:"status"`
-	OrderType             string         `json:"orderType"`
-	Profit                float64        `json:"profit"`
+	DealStatus            DealStatus     `json:"dealStatus"`
+	Reason                DealReason     `json:"reason"`
+	Status                PositionStatus `json:"status"`
+	OrderType             OrderType      `json:"orderType"`
+	Profit                Decimal        `json:"profit"`
 	ProfitCurrency        string         `json:"profitCurrency"`
 	CurrencyCode          string         `json:"currencyCode"`
-	Direction             string         `json:"direction"` // "BUY" or "SELL"
+	Direction             Direction      `json:"direction"`
 	Expiry                string         `json:"expiry,omitempty"`
-	Size                  float64        `json:"size"` // Deal size
-	StopDistance          float64        `json:"stopDistance"`
-	StopLevel             float64        `json:"stopLevel"`
-	LimitDistance         float64        `json:"limitDistance,omitempty"`
-	LimitLevel            float64        `json:"limitLevel"`
+	Size                  Decimal        `json:"size"` // Deal size
+	StopDistance          Decimal        `json:"stopDistance"`
+	StopLevel             Decimal        `json:"stopLevel"`
+	LimitDistance         Decimal        `json:"limitDistance"`
+	LimitLevel            Decimal        `json:"limitLevel"`
 	QuoteID               string         `json:"quoteId,omitempty"`
-	TimeInForce           string         `json:"timeInForce,omitempty"` // "EXECUTE_AND_ELIMINATE" or "FILL_OR_KILL"
+	TimeInForce           TimeInForce    `json:"timeInForce,omitempty"`
 	TrailingStop          bool           `json:"trailingStop"`
-	TrailingStopIncrement float64        `json:"trailingIncrement"`
+	TrailingStopIncrement Decimal        `json:"trailingIncrement"`
 	GuaranteedStop        bool           `json:"guaranteedStop"`
 	DealReference         string         `json:"dealReference,omitempty"`
 }
 
 // OTCUpdateOrderRequest - request struct for updating orders
 type OTCUpdateOrderRequest struct {
-	StopLevel             float64 `json:"stopLevel"`
-	LimitLevel            float64 `json:"limitLevel"`
+	StopLevel             Decimal `json:"stopLevel"`
+	LimitLevel            Decimal `json:"limitLevel"`
 	TrailingStop          bool    `json:"trailingStop"`
-	TrailingStopIncrement string  `json:"trailingStopIncrement,omitempty"`
+	TrailingStopIncrement Decimal `json:"trailingStopIncrement"`
 }
 
 // OTCWorkingOrderRequest - request struct for placing workingorders
 type OTCWorkingOrderRequest struct {
-	CurrencyCode   string  `json:"currencyCode"`
-	DealReference  string  `json:"dealReference,omitempty"`
-	Direction      string  `json:"direction"` // "BUY" or "SELL"
-	Epic           string  `json:"epic"`
-	Expiry         string  `json:"expiry"`
-	ForceOpen      bool    `json:"forceOpen"`
-	GoodTillDate   string  `json:"goodTillDate,omitempty"`
-	GuaranteedStop bool    `json:"guaranteedStop"`
-	Level          float64 `json:"level"`
-	LimitDistance  string  `json:"limitDistance,omitempty"`
-	LimitLevel     string  `json:"limitLevel,omitempty"`
-	Size           float64 `json:"size"` // Deal size
-	StopDistance   string  `json:"stopDistance,omitempty"`
-	StopLevel      string  `json:"stopLevel,omitempty"`
-	TimeInForce    string  `json:"timeInForce,omitempty"` // "GOOD_TILL_CANCELLED", "GOOD_TILL_DATE"
-	Type           string  `json:"type"`
+	CurrencyCode   string           `json:"currencyCode"`
+	DealReference  string           `json:"dealReference,omitempty"`
+	Direction      Direction        `json:"direction"`
+	Epic           string           `json:"epic"`
+	Expiry         string           `json:"expiry"`
+	ForceOpen      bool             `json:"forceOpen"`
+	GoodTillDate   string           `json:"goodTillDate,omitempty"`
+	GuaranteedStop bool             `json:"guaranteedStop"`
+	Level          Decimal          `json:"level"`
+	LimitDistance  Decimal          `json:"limitDistance"`
+	LimitLevel     Decimal          `json:"limitLevel"`
+	Size           Decimal          `json:"size"` // Deal size
+	StopDistance   Decimal          `json:"stopDistance"`
+	StopLevel      Decimal          `json:"stopLevel"`
+	TimeInForce    TimeInForce      `json:"timeInForce,omitempty"` // TimeInForceGoodTillCancelled or TimeInForceGoodTillDate
+	Type           WorkingOrderType `json:"type"`
+}
+
+// OTCUpdateWorkingOrderRequest - request struct for updating workingorders. Stops and limits not set are removed.
+type OTCUpdateWorkingOrderRequest struct {
+	GoodTillDate  string           `json:"goodTillDate,omitempty"` // Required for TimeInForceGoodTillDate, e.g. "2024/12/31 23:59"
+	Level         Decimal          `json:"level"`
+	LimitDistance Decimal          `json:"limitDistance"`
+	LimitLevel    Decimal          `json:"limitLevel"`
+	StopDistance  Decimal          `json:"stopDistance"`
+	StopLevel     Decimal          `json:"stopLevel"`
+	TimeInForce   TimeInForce      `json:"timeInForce"` // Required, TimeInForceGoodTillCancelled or TimeInForceGoodTillDate
+	Type          WorkingOrderType `json:"type"`        // Required
 }
 
 // WorkingOrders - Working orders
@@ -143,6 +156,10 @@ type OTCWorkingOrder struct {
 
 // DeletePositionsOTC - Closes one or more OTC positions
 func (ig *IGMarkets) DeletePositionsOTC(ctx context.Context) error {
+	if ig.dealer != nil {
+		return fmt.Errorf("igmarkets: DeletePositionsOTC is not supported with a dealer")
+	}
+
 	bodyReq := new(bytes.Buffer)
 
 	req, err := http.NewRequest("DELETE", ig.APIURL+"/gateway/deal/positions/otc", bodyReq)
@@ -150,12 +167,20 @@ func (ig *IGMarkets) DeletePositionsOTC(ctx context.Context) error {
 		return fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	_, err = ig.doRequest(ctx, req, 1, nil)
+	err = ig.doWithoutResponse(ctx, req, 1)
 	return err
 }
 
 // PlaceOTCWorkingOrder - Place an OTC workingorder
 func (ig *IGMarkets) PlaceOTCWorkingOrder(ctx context.Context, order OTCWorkingOrderRequest) (*DealReference, error) {
+	order, err := ig.preflightOTCWorkingOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if ig.dealer != nil {
+		return ig.dealer.PlaceOTCWorkingOrder(ctx, order)
+	}
+
 	bodyReq, err := json.Marshal(&order)
 	if err != nil {
 		return nil, fmt.Errorf("igmarkets: unable to marshal JSON: %v", err)
@@ -165,32 +190,44 @@ func (ig *IGMarkets) PlaceOTCWorkingOrder(ctx context.Context, order OTCWorkingO
 		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, DealReference{})
+	// A retry is only safe when IG can detect the duplicate by its deal reference
+	if order.DealReference != "" {
+		ctx = withIdempotentRequest(ctx)
+	}
+
+	igResponse, err := do[DealReference](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
-	return igResponseInterface.(*DealReference), err
+	return igResponse, nil
 }
 
 // GetOTCWorkingOrders - Get all working orders
 func (ig *IGMarkets) GetOTCWorkingOrders(ctx context.Context) (*WorkingOrders, error) {
+	if ig.dealer != nil {
+		return ig.dealer.GetOTCWorkingOrders(ctx)
+	}
+
 	bodyReq := new(bytes.Buffer)
 	req, err := http.NewRequest("GET", ig.APIURL+"/gateway/deal/workingorders/", bodyReq)
 	if err != nil {
 		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, WorkingOrders{})
+	igResponse, err := do[WorkingOrders](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
-	igResponse, _ := igResponseInterface.(*WorkingOrders)
 
 	return igResponse, err
 }
 
 // DeleteOTCWorkingOrder - Delete OTC working order
 func (ig *IGMarkets) DeleteOTCWorkingOrder(ctx context.Context, dealRef string) (*DealReference, error) {
+	if ig.dealer != nil {
+		return ig.dealer.DeleteOTCWorkingOrder(ctx, dealRef)
+	}
+
 	bodyReq := new(bytes.Buffer)
 
 	req, err := http.NewRequest("DELETE", ig.APIURL+"/gateway/deal/workingorders/otc/"+dealRef, bodyReq)
@@ -198,16 +235,46 @@ func (ig *IGMarkets) DeleteOTCWorkingOrder(ctx context.Context, dealRef string)
 		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, DealReference{})
+	igResponse, err := do[DealReference](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
 
-	return igResponseInterface.(*DealReference), nil
+	return igResponse, nil
+}
+
+// UpdateOTCWorkingOrder - Update level, stop, limit and expiry of an OTC working order
+func (ig *IGMarkets) UpdateOTCWorkingOrder(ctx context.Context, dealID string, order OTCUpdateWorkingOrderRequest) (*DealReference, error) {
+	if ig.dealer != nil {
+		return ig.dealer.UpdateOTCWorkingOrder(ctx, dealID, order)
+	}
+
+	bodyReq, err := json.Marshal(&order)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to marshal JSON: %v", err)
+	}
+	req, err := http.NewRequest("PUT", ig.APIURL+"/gateway/deal/workingorders/otc/"+dealID, bytes.NewReader(bodyReq))
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
+	}
+
+	igResponse, err := do[DealReference](ctx, ig, req, 2)
+	if err != nil {
+		return nil, err
+	}
+	return igResponse, nil
 }
 
 // PlaceOTCOrder - Place an OTC order
 func (ig *IGMarkets) PlaceOTCOrder(ctx context.Context, order OTCOrderRequest) (*DealReference, error) {
+	order, err := ig.preflightOTCOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if ig.dealer != nil {
+		return ig.dealer.PlaceOTCOrder(ctx, order)
+	}
+
 	bodyReq, err := json.Marshal(&order)
 	if err != nil {
 		return nil, fmt.Errorf("igmarkets: cannot marshal: %v", err)
@@ -217,15 +284,24 @@ func (ig *IGMarkets) PlaceOTCOrder(ctx context.Context, order OTCOrderRequest) (
 		return nil, fmt.Errorf("igmarkets: cannot create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, DealReference{})
+	// IG rejects duplicated deal references, so only orders with their own reference can be retried safely
+	if order.DealReference != "" {
+		ctx = withIdempotentRequest(ctx)
+	}
+
+	igResponse, err := do[DealReference](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
-	return igResponseInterface.(*DealReference), nil
+	return igResponse, nil
 }
 
 // UpdateOTCOrder - Update an exisiting OTC order
 func (ig *IGMarkets) UpdateOTCOrder(ctx context.Context, dealID string, order OTCUpdateOrderRequest) (*DealReference, error) {
+	if ig.dealer != nil {
+		return ig.dealer.UpdateOTCOrder(ctx, dealID, order)
+	}
+
 	bodyReq, err := json.Marshal(&order)
 	if err != nil {
 		return nil, fmt.Errorf("igmarkets: cannot marshal: %v", err)
@@ -235,15 +311,19 @@ func (ig *IGMarkets) UpdateOTCOrder(ctx context.Context, dealID string, order OT
 		return nil, fmt.Errorf("igmarkets: cannot create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, DealReference{})
+	igResponse, err := do[DealReference](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
-	return igResponseInterface.(*DealReference), err
+	return igResponse, nil
 }
 
 // CloseOTCPosition - Close an OTC position
 func (ig *IGMarkets) CloseOTCPosition(ctx context.Context, close OTCPositionCloseRequest) (*DealReference, error) {
+	if ig.dealer != nil {
+		return ig.dealer.CloseOTCPosition(ctx, close)
+	}
+
 	bodyReq, err := json.Marshal(&close)
 	if err != nil {
 		return nil, fmt.Errorf("igmarkets: cannot marshal: %v", err)
@@ -255,15 +335,19 @@ func (ig *IGMarkets) CloseOTCPosition(ctx context.Context, close OTCPositionClos
 
 	req.Header.Set("_method", "DELETE")
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, DealReference{})
+	igResponse, err := do[DealReference](ctx, ig, req, 1)
 	if err != nil {
 		return nil, err
 	}
-	return igResponseInterface.(*DealReference), nil
+	return igResponse, nil
 }
 
 // GetDealConfirmation - Check if the given order was closed/filled
 func (ig *IGMarkets) GetDealConfirmation(ctx context.Context, dealRef string) (*OTCDealConfirmation, error) {
+	if ig.dealer != nil {
+		return ig.dealer.GetDealConfirmation(ctx, dealRef)
+	}
+
 	bodyReq := new(bytes.Buffer)
 
 	req, err := http.NewRequest("GET", ig.APIURL+"/gateway/deal/confirms/"+dealRef, bodyReq)
@@ -271,11 +355,10 @@ func (ig *IGMarkets) GetDealConfirmation(ctx context.Context, dealRef string) (*
 		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, OTCDealConfirmation{})
+	igResponse, err := do[OTCDealConfirmation](ctx, ig, req, 1)
 	if err != nil {
 		return nil, err
 	}
-	igResponse, _ := igResponseInterface.(*OTCDealConfirmation)
 
 	return igResponse, nil
 }
@@ -0,0 +1,283 @@
+// Package paper trades against live prices without sending orders to IG. The dealing methods of the client are
+// served from an in-memory book, see WithTrader().
+package paper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sklinkert/igmarkets"
+	"github.com/sklinkert/igmarkets/internal/dealing"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Close reasons of Trade
+const (
+	CloseManual = dealing.CloseManual
+	CloseStop   = dealing.CloseStop
+	CloseLimit  = dealing.CloseLimit
+)
+
+// Trade - Position (partially) closed by the paper trader
+type Trade struct {
+	DealID     string
+	Epic       string
+	Direction  igmarkets.Direction // Direction of the position
+	Size       igmarkets.Decimal
+	OpenLevel  igmarkets.Decimal
+	CloseLevel igmarkets.Decimal
+	Profit     igmarkets.Decimal // (CloseLevel - OpenLevel) * Size * ContractSize, negated for SELL positions
+	Reason     string            // CloseManual, CloseStop or CloseLimit
+	ClosedAt   time.Time
+}
+
+// quote - Last known bid and ask of an epic
+type quote struct {
+	bid, ask igmarkets.Decimal
+}
+
+// Trader - In-memory dealing book used instead of IG's dealing endpoints, see WithTrader().
+// Market orders are filled at the last LightStreamerTick of the epic or, without tick, at the quote of
+// GetPrice(). Stops, limits and working orders are triggered by ticks.
+type Trader struct {
+	mu         sync.Mutex
+	book       *dealing.Book
+	quotes     map[string]quote
+	fetchQuote func(ctx context.Context, epic string) (bid, ask igmarkets.Decimal, err error)
+}
+
+// NewTrader - Create an empty book
+func NewTrader() *Trader {
+	return &Trader{
+		book:   dealing.NewBook("DIAAAAPAPER", "PAPER"),
+		quotes: make(map[string]quote),
+	}
+}
+
+// WithTrader - Serve PlaceOTCOrder(), PlaceOTCWorkingOrder(), UpdateOTCOrder(), UpdateOTCWorkingOrder(),
+// CloseOTCPosition(), DeleteOTCWorkingOrder(), GetPositions(), GetOTCWorkingOrders() and GetDealConfirmation()
+// from the paper trader. All other requests, e.g. for prices, are still sent to IG.
+func WithTrader(trader *Trader) igmarkets.Option {
+	return func(ig *igmarkets.IGMarkets) error {
+		if trader == nil {
+			return fmt.Errorf("igmarkets: paper trader must not be nil")
+		}
+		trader.mu.Lock()
+		trader.fetchQuote = func(ctx context.Context, epic string) (igmarkets.Decimal, igmarkets.Decimal, error) {
+			return latestQuote(ctx, ig, epic)
+		}
+		trader.mu.Unlock()
+		return igmarkets.WithDealer(trader)(ig)
+	}
+}
+
+// latestQuote - Bid and ask of the latest snapshot returned by GetPrice()
+func latestQuote(ctx context.Context, ig *igmarkets.IGMarkets, epic string) (igmarkets.Decimal, igmarkets.Decimal, error) {
+	prices, err := ig.GetPrice(ctx, epic)
+	if err != nil {
+		return igmarkets.Decimal{}, igmarkets.Decimal{}, err
+	}
+	if len(prices.Prices) == 0 {
+		return igmarkets.Decimal{}, igmarkets.Decimal{}, fmt.Errorf("igmarkets: no price for %q", epic)
+	}
+	latest := prices.Prices[len(prices.Prices)-1].ClosePrice
+	return latest.Bid, latest.Ask, nil
+}
+
+// Trades - Positions closed so far, oldest first
+func (t *Trader) Trades() []Trade {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var trades []Trade
+	for _, trade := range t.book.Trades() {
+		trades = append(trades, Trade(trade))
+	}
+	return trades
+}
+
+// OnTick - Update the quote of the epic and trigger stops, limits and working orders.
+// Called for every tick of OpenLightStreamerSubscription() by clients created with WithTrader().
+func (t *Trader) OnTick(tick igmarkets.LightStreamerTick) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	q := t.quotes[tick.Epic]
+	if !tick.Bid.IsZero() {
+		q.bid = tick.Bid
+	}
+	if !tick.Ask.IsZero() {
+		q.ask = tick.Ask
+	}
+	t.quotes[tick.Epic] = q
+	if q.bid.IsZero() || q.ask.IsZero() {
+		return
+	}
+	t.book.Trigger(tick.Epic, q.bid, q.ask)
+}
+
+// quote - Last tick of the epic or the latest price from IG; must be called without the lock
+func (t *Trader) quote(ctx context.Context, epic string) (quote, error) {
+	t.mu.Lock()
+	q, found := t.quotes[epic]
+	fetchQuote := t.fetchQuote
+	t.mu.Unlock()
+	if found && !q.bid.IsZero() && !q.ask.IsZero() {
+		return q, nil
+	}
+	if fetchQuote == nil {
+		return quote{}, fmt.Errorf("igmarkets: no quote for %q", epic)
+	}
+
+	bid, ask, err := fetchQuote(ctx, epic)
+	if err != nil {
+		return quote{}, err
+	}
+	return quote{bid: bid, ask: ask}, nil
+}
+
+// PlaceOTCOrder - Fill the order at the current quote
+func (t *Trader) PlaceOTCOrder(ctx context.Context, order igmarkets.OTCOrderRequest) (*igmarkets.DealReference, error) {
+	q, err := t.quote(ctx, order.Epic)
+	if err != nil {
+		return nil, err
+	}
+
+	level := q.ask
+	if order.Direction == igmarkets.DirectionSell {
+		level = q.bid
+	}
+	var reason igmarkets.DealReason
+	switch {
+	case order.Size.Sign() <= 0:
+		reason = igmarkets.DealReasonMinimumOrderSizeError
+	case order.OrderType == igmarkets.OrderTypeLimit && !order.Level.IsZero() && worse(level, order.Level, order.Direction):
+		reason = igmarkets.DealReasonLevelToleranceError
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dealRef, err := t.book.PlaceOrder(order, level, reason)
+	return dealRef, apiError("POST", "/gateway/deal/positions/otc", 2, err)
+}
+
+// CloseOTCPosition - Close the position at the current quote
+func (t *Trader) CloseOTCPosition(ctx context.Context, close igmarkets.OTCPositionCloseRequest) (*igmarkets.DealReference, error) {
+	t.mu.Lock()
+	position, found := t.book.FindPosition(close)
+	if !found {
+		defer t.mu.Unlock()
+		return t.book.ClosePosition(close, igmarkets.Decimal{}), nil
+	}
+	t.mu.Unlock()
+
+	q, err := t.quote(ctx, position.MarketData.Epic)
+	if err != nil {
+		return nil, err
+	}
+	level := q.bid
+	if close.Direction == igmarkets.DirectionBuy {
+		level = q.ask
+	}
+
+	// The book may have changed while fetching the quote, it rejects the order if the position is gone
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.book.ClosePosition(close, level), nil
+}
+
+// UpdateOTCOrder - Replace stop and limit level of the position
+func (t *Trader) UpdateOTCOrder(_ context.Context, dealID string, order igmarkets.OTCUpdateOrderRequest) (*igmarkets.DealReference, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.book.UpdatePosition(dealID, order), nil
+}
+
+// GetPositions - Open positions with the last known quote
+func (t *Trader) GetPositions(_ context.Context) (*igmarkets.PositionsResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	positions := t.book.Positions()
+	for i, position := range positions {
+		q := t.quotes[position.MarketData.Epic]
+		positions[i].MarketData.Bid = q.bid
+		positions[i].MarketData.Offer = q.ask
+	}
+	return &igmarkets.PositionsResponse{Positions: positions}, nil
+}
+
+// PlaceOTCWorkingOrder - Add the working order to the book
+func (t *Trader) PlaceOTCWorkingOrder(_ context.Context, order igmarkets.OTCWorkingOrderRequest) (*igmarkets.DealReference, error) {
+	var reason igmarkets.DealReason
+	if order.Size.Sign() <= 0 {
+		reason = igmarkets.DealReasonMinimumOrderSizeError
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dealRef, err := t.book.PlaceWorkingOrder(order, igmarkets.MarketData{Epic: order.Epic}, reason)
+	return dealRef, apiError("POST", "/gateway/deal/workingorders/otc", 2, err)
+}
+
+// UpdateOTCWorkingOrder - Replace level, stop, limit and expiry of the working order
+func (t *Trader) UpdateOTCWorkingOrder(_ context.Context, dealID string, order igmarkets.OTCUpdateWorkingOrderRequest) (*igmarkets.DealReference, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dealRef, err := t.book.UpdateWorkingOrder(dealID, order)
+	return dealRef, apiError("PUT", "/gateway/deal/workingorders/otc/"+dealID, 2, err)
+}
+
+// DeleteOTCWorkingOrder - Remove the working order from the book
+func (t *Trader) DeleteOTCWorkingOrder(_ context.Context, dealID string) (*igmarkets.DealReference, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dealRef, err := t.book.DeleteWorkingOrder(dealID)
+	return dealRef, apiError("DELETE", "/gateway/deal/workingorders/otc/"+dealID, 2, err)
+}
+
+// GetOTCWorkingOrders - Pending working orders
+func (t *Trader) GetOTCWorkingOrders(_ context.Context) (*igmarkets.WorkingOrders, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &igmarkets.WorkingOrders{WorkingOrders: t.book.WorkingOrders()}, nil
+}
+
+// GetDealConfirmation - Confirmation of an order of the paper trader
+func (t *Trader) GetDealConfirmation(_ context.Context, dealRef string) (*igmarkets.OTCDealConfirmation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	confirm, found := t.book.Confirmation(dealRef)
+	if !found {
+		return nil, apiError("GET", "/gateway/deal/confirms/"+dealRef, 1,
+			&dealing.Error{StatusCode: http.StatusNotFound, ErrorCode: "error.confirms.deal-not-found"})
+	}
+	return confirm, nil
+}
+
+// apiError - Error IG would have returned for the request, nil if err is nil
+func apiError(method, endpoint string, version int, err error) error {
+	var bookErr *dealing.Error
+	if !errors.As(err, &bookErr) {
+		return err
+	}
+	return &igmarkets.APIError{
+		StatusCode: bookErr.StatusCode,
+		ErrorCode:  bookErr.ErrorCode,
+		Method:     method,
+		Endpoint:   endpoint,
+		Version:    version,
+		Body:       []byte(fmt.Sprintf(`{"errorCode":%q}`, bookErr.ErrorCode)),
+	}
+}
+
+// worse - True if level is worse than limit for an order in the given direction
+func worse(level, limit igmarkets.Decimal, direction igmarkets.Direction) bool {
+	if direction == igmarkets.DirectionSell {
+		return level.Cmp(limit) < 0
+	}
+	return level.Cmp(limit) > 0
+}
@@ -0,0 +1,163 @@
+package paper
+
+import (
+	"context"
+	"errors"
+	"github.com/AMekss/assert"
+	"github.com/sklinkert/igmarkets"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPaperTrading(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/gateway/deal/prices/CS.D.EURUSD.CFD.IP" {
+			_, _ = w.Write([]byte(`{"prices":[{"closePrice":{"bid":1.1000,"ask":1.1002}}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	trader := NewTrader()
+	igm, err := igmarkets.NewWithOptions(igmarkets.WithBaseURL(server.URL), WithTrader(trader))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	const epic = "CS.D.EURUSD.CFD.IP"
+
+	// Without tick the order is filled at the quote of GetPrice()
+	dealRef, err := igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: epic, Direction: "BUY", Size: igmarkets.DecimalFromFloat(2), OrderType: "MARKET",
+		StopDistance: igmarkets.DecimalFromFloat(0.0050), LimitLevel: igmarkets.DecimalFromFloat(1.1100), DealReference: "order-1"})
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "order-1", dealRef.DealReference)
+	confirm, err := igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "ACCEPTED", string(confirm.DealStatus))
+	assert.EqualFloat64(t, 1.1002, confirm.Level.Float64())
+	assert.EqualFloat64(t, 1.0952, confirm.StopLevel.Float64())
+	assert.EqualFloat64(t, 1.11, confirm.LimitLevel.Float64())
+	_, err = igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: epic, Direction: "BUY", Size: igmarkets.DecimalFromFloat(1), DealReference: "order-1"})
+	assert.True(t, err != nil)
+
+	positions, err := igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(positions.Positions))
+	dealID := positions.Positions[0].Position.DealID
+	assert.EqualStrings(t, confirm.DealID, dealID)
+
+	// Stop is hit by the bid of a tick
+	trader.OnTick(igmarkets.LightStreamerTick{Epic: epic, Time: time.Now(), Bid: igmarkets.DecimalFromFloat(1.1050), Ask: igmarkets.DecimalFromFloat(1.1052)})
+	_, err = igm.UpdateOTCOrder(ctx, dealID, igmarkets.OTCUpdateOrderRequest{StopLevel: igmarkets.DecimalFromFloat(1.1040), LimitLevel: igmarkets.DecimalFromFloat(1.1100)})
+	assert.NoError(t, err)
+	trader.OnTick(igmarkets.LightStreamerTick{Epic: epic, Time: time.Now(), Bid: igmarkets.DecimalFromFloat(1.1039), Ask: igmarkets.DecimalFromFloat(1.1041)})
+	positions, err = igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 0, len(positions.Positions))
+	trades := trader.Trades()
+	assert.EqualInt(t, 1, len(trades))
+	assert.EqualStrings(t, CloseStop, trades[0].Reason)
+	assert.EqualFloat64(t, 1.1039, trades[0].CloseLevel.Float64())
+
+	// Working orders are triggered by ticks
+	dealRef, err = igm.PlaceOTCWorkingOrder(ctx, igmarkets.OTCWorkingOrderRequest{Epic: epic, Direction: "SELL", Size: igmarkets.DecimalFromFloat(1), Level: igmarkets.DecimalFromFloat(1.1100),
+		Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED", LimitDistance: igmarkets.DecimalFromFloat(0.0100)})
+	assert.NoError(t, err)
+	orders, err := igm.GetOTCWorkingOrders(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(orders.WorkingOrders))
+	dealRef, err = igm.UpdateOTCWorkingOrder(ctx, orders.WorkingOrders[0].WorkingOrderData.DealID, igmarkets.OTCUpdateWorkingOrderRequest{
+		Level: igmarkets.DecimalFromFloat(1.1105), LimitLevel: igmarkets.DecimalFromFloat(1.1005), Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED"})
+	assert.NoError(t, err)
+	confirm, err = igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "AMENDED", string(confirm.Status))
+	_, err = igm.UpdateOTCWorkingOrder(ctx, "unknown", igmarkets.OTCUpdateWorkingOrderRequest{Level: igmarkets.DecimalFromFloat(1), Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED"})
+	var apiErr *igmarkets.APIError
+	assert.True(t, errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound)
+	_, err = igm.UpdateOTCWorkingOrder(ctx, orders.WorkingOrders[0].WorkingOrderData.DealID, igmarkets.OTCUpdateWorkingOrderRequest{Level: igmarkets.DecimalFromFloat(1), Type: "LIMIT"})
+	assert.True(t, errors.As(err, &apiErr) && apiErr.ErrorCode == "validation.null-not-allowed.request.timeInForce")
+	trader.OnTick(igmarkets.LightStreamerTick{Epic: epic, Time: time.Now(), Bid: igmarkets.DecimalFromFloat(1.1099), Ask: igmarkets.DecimalFromFloat(1.1101)})
+	orders, err = igm.GetOTCWorkingOrders(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(orders.WorkingOrders))
+	trader.OnTick(igmarkets.LightStreamerTick{Epic: epic, Time: time.Now(), Bid: igmarkets.DecimalFromFloat(1.1105), Ask: igmarkets.DecimalFromFloat(1.1107)})
+	orders, err = igm.GetOTCWorkingOrders(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 0, len(orders.WorkingOrders))
+	positions, err = igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(positions.Positions))
+	assert.EqualFloat64(t, 1.1105, positions.Positions[0].Position.Level.Float64())
+	assert.EqualFloat64(t, 1.1005, positions.Positions[0].Position.LimitLevel.Float64())
+
+	// Partial close at the ask of the last tick
+	dealRef, err = igm.CloseOTCPosition(ctx, igmarkets.OTCPositionCloseRequest{DealID: positions.Positions[0].Position.DealID,
+		Direction: "BUY", Size: igmarkets.DecimalFromFloat(0.5), OrderType: "MARKET"})
+	assert.NoError(t, err)
+	confirm, err = igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "PARTIALLY_CLOSED", string(confirm.Status))
+	assert.EqualFloat64(t, -0.0001, confirm.Profit.Float64())
+
+	dealRef, err = igm.CloseOTCPosition(ctx, igmarkets.OTCPositionCloseRequest{DealID: "unknown", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1)})
+	assert.NoError(t, err)
+	confirm, err = igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "REJECTED", string(confirm.DealStatus))
+	assert.EqualStrings(t, "POSITION_NOT_FOUND", string(confirm.Reason))
+
+	_, err = igm.GetDealConfirmation(ctx, "unknown")
+	assert.True(t, errors.Is(err, igmarkets.ErrDealNotFound))
+
+	// Only prices were requested from IG
+	mu.Lock()
+	defer mu.Unlock()
+	assert.EqualInt(t, 2, len(paths))
+	for _, path := range paths {
+		assert.EqualStrings(t, "GET /gateway/deal/prices/CS.D.EURUSD.CFD.IP", path)
+	}
+}
+
+func TestPaperTradingOrderLevelsAndNetting(t *testing.T) {
+	trader := NewTrader()
+	igm, err := igmarkets.NewWithOptions(WithTrader(trader))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	const epic = "IX.D.DAX.DAILY.IP"
+	trader.OnTick(igmarkets.LightStreamerTick{Epic: epic, Time: time.Now(), Bid: igmarkets.DecimalFromFloat(99), Ask: igmarkets.DecimalFromFloat(101)})
+
+	// Stop and limit of working orders may be given as levels
+	_, err = igm.PlaceOTCWorkingOrder(ctx, igmarkets.OTCWorkingOrderRequest{Epic: epic, Direction: "BUY", Size: igmarkets.DecimalFromFloat(1), Level: igmarkets.DecimalFromFloat(100),
+		Type: "LIMIT", TimeInForce: "GOOD_TILL_CANCELLED", StopLevel: igmarkets.DecimalFromFloat(90), LimitLevel: igmarkets.DecimalFromFloat(120)})
+	assert.NoError(t, err)
+	trader.OnTick(igmarkets.LightStreamerTick{Epic: epic, Time: time.Now(), Bid: igmarkets.DecimalFromFloat(98), Ask: igmarkets.DecimalFromFloat(100)})
+	positions, err := igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(positions.Positions))
+	assert.EqualFloat64(t, 90, positions.Positions[0].Position.StopLevel.Float64())
+	assert.EqualFloat64(t, 120, positions.Positions[0].Position.LimitLevel.Float64())
+
+	// An opposite order larger than the position closes it and opens the rest in the new direction
+	dealRef, err := igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: epic, Direction: "SELL", Size: igmarkets.DecimalFromFloat(3), OrderType: "MARKET"})
+	assert.NoError(t, err)
+	confirm, err := igm.GetDealConfirmation(ctx, dealRef.DealReference)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "OPEN", string(confirm.Status))
+	assert.EqualFloat64(t, -2, confirm.Profit.Float64())
+	assert.EqualInt(t, 2, len(confirm.AffectedDeals))
+	assert.EqualStrings(t, "FULLY_CLOSED", confirm.AffectedDeals[0].Constant)
+	positions, err = igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualInt(t, 1, len(positions.Positions))
+	assert.EqualStrings(t, "SELL", string(positions.Positions[0].Position.Direction))
+	assert.EqualFloat64(t, 2, positions.Positions[0].Position.Size.Float64())
+	assert.EqualFloat64(t, -2, trader.Trades()[0].Profit.Float64())
+}
@@ -16,25 +16,29 @@ type PositionsResponse struct {
 type Position struct {
 	MarketData MarketData `json:"market"`
 	Position   struct {
-		ContractSize         float64 `json:"contractSize"`
-		ControlledRisk       bool    `json:"controlledRisk"`
-		CreatedDate          string  `json:"createdDate"`
-		CreatedDateUTC       string  `json:"createdDateUTC"`
-		Currency             string  `json:"currency"`
-		DealID               string  `json:"dealId"`
-		DealReference        string  `json:"dealReference"`
-		Direction            string  `json:"direction"`
-		Level                float64 `json:"level"`
-		LimitLevel           float64 `json:"limitLevel"`
-		Size                 float64 `json:"size"`
-		StopLevel            float64 `json:"stopLevel"`
-		TrailingStep         float64 `json:"trailingStep"`
-		TrailingStopDistance float64 `json:"trailingStopDistance"`
+		ContractSize         Decimal   `json:"contractSize"`
+		ControlledRisk       bool      `json:"controlledRisk"`
+		CreatedDate          string    `json:"createdDate"`
+		CreatedDateUTC       string    `json:"createdDateUTC"`
+		Currency             string    `json:"currency"`
+		DealID               string    `json:"dealId"`
+		DealReference        string    `json:"dealReference"`
+		Direction            Direction `json:"direction"`
+		Level                Decimal   `json:"level"`
+		LimitLevel           Decimal   `json:"limitLevel"`
+		Size                 Decimal   `json:"size"`
+		StopLevel            Decimal   `json:"stopLevel"`
+		TrailingStep         Decimal   `json:"trailingStep"`
+		TrailingStopDistance Decimal   `json:"trailingStopDistance"`
 	} `json:"position"`
 }
 
 // GetPositions - Get all open positions
 func (ig *IGMarkets) GetPositions(ctx context.Context) (*PositionsResponse, error) {
+	if ig.dealer != nil {
+		return ig.dealer.GetPositions(ctx)
+	}
+
 	bodyReq := new(bytes.Buffer)
 
 	req, err := http.NewRequest("GET", ig.APIURL+"/gateway/deal/positions/", bodyReq)
@@ -42,11 +46,10 @@ func (ig *IGMarkets) GetPositions(ctx context.Context) (*PositionsResponse, erro
 		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, PositionsResponse{})
+	igResponse, err := do[PositionsResponse](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
 
-	igResponse, _ := igResponseInterface.(*PositionsResponse)
 	return igResponse, nil
 }
@@ -50,9 +50,9 @@ type PriceResponse struct {
 
 // Price - Subset of PriceResponse
 type Price struct {
-	Bid        float64 `json:"bid"`
-	Ask        float64 `json:"ask"`
-	LastTraded float64 `json:"lastTraded"` // Last traded price
+	Bid        Decimal `json:"bid"`
+	Ask        Decimal `json:"ask"`
+	LastTraded Decimal `json:"lastTraded"` // Last traded price
 }
 
 // GetPriceHistory - Returns a list of historical prices for the given epic, resolution and number of data points
@@ -77,11 +77,10 @@ func (ig *IGMarkets) GetPriceHistory(ctx context.Context, epic, resolution strin
 		return nil, fmt.Errorf("igmarkets: unable to get price: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 3, PriceResponse{})
+	priceResponse, err := do[PriceResponse](ctx, ig, req, 3)
 	if err != nil {
 		return nil, err
 	}
-	priceResponse, _ := igResponseInterface.(*PriceResponse)
 
 	for i := range priceResponse.Prices {
 		priceResponse.Prices[i].SnapshotTimeUTCParsed, _ =
@@ -0,0 +1,201 @@
+package igmarkets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClientRateLimited - The client-side rate limiter refused the request (RateLimitFailFast only)
+var ErrClientRateLimited = errors.New("igmarkets: client-side rate limit reached")
+
+// RequestClass - IG allowance a request is counted against
+type RequestClass int
+
+const (
+	// RequestClassNonTrading - Markets, accounts, watchlists, history, ... (per app allowance)
+	RequestClassNonTrading RequestClass = iota
+	// RequestClassTrading - Creating, updating and closing positions and working orders (per account allowance)
+	RequestClassTrading
+	// RequestClassHistoricalPrices - Price history requests (weekly data point allowance)
+	RequestClassHistoricalPrices
+)
+
+func (c RequestClass) String() string {
+	switch c {
+	case RequestClassTrading:
+		return "trading"
+	case RequestClassHistoricalPrices:
+		return "historical_prices"
+	default:
+		return "non_trading"
+	}
+}
+
+// RateLimitPolicy - Behaviour when a bucket has not enough tokens left
+type RateLimitPolicy int
+
+const (
+	// RateLimitBlock - Wait until enough tokens are available or the context is done
+	RateLimitBlock RateLimitPolicy = iota
+	// RateLimitFailFast - Return ErrClientRateLimited immediately
+	RateLimitFailFast
+)
+
+// RateLimitConfig - Allowances enforced by the RateLimiter
+type RateLimitConfig struct {
+	TradingPerMinute            int // Trading requests per account and minute
+	NonTradingPerMinute         int // Non-trading requests per app and minute
+	HistoricalDataPointsPerWeek int // Historical price data points per week
+	Policy                      RateLimitPolicy
+}
+
+// DefaultRateLimitConfig - IG's documented default allowances
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		TradingPerMinute:            100,
+		NonTradingPerMinute:         60,
+		HistoricalDataPointsPerWeek: 10000,
+		Policy:                      RateLimitBlock,
+	}
+}
+
+// BucketLevel - Snapshot of a token bucket
+type BucketLevel struct {
+	Class     RequestClass
+	Available float64 // Tokens currently available
+	Capacity  float64 // Maximum number of tokens
+}
+
+// RateLimiter - Token bucket rate limiter shared by all goroutines using the same IGMarkets instance
+type RateLimiter struct {
+	policy  RateLimitPolicy
+	buckets map[RequestClass]*tokenBucket
+	now     func() time.Time
+	sync.Mutex
+}
+
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+// NewRateLimiter - Create rate limiter with full buckets
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		policy:  config.Policy,
+		buckets: make(map[RequestClass]*tokenBucket, 3),
+		now:     time.Now,
+	}
+	now := l.now()
+	l.buckets[RequestClassTrading] = newTokenBucket(config.TradingPerMinute, time.Minute, now)
+	l.buckets[RequestClassNonTrading] = newTokenBucket(config.NonTradingPerMinute, time.Minute, now)
+	l.buckets[RequestClassHistoricalPrices] = newTokenBucket(config.HistoricalDataPointsPerWeek, 7*24*time.Hour, now)
+	return l
+}
+
+func newTokenBucket(capacity int, period time.Duration, now time.Time) *tokenBucket {
+	if capacity <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		rate:     float64(capacity) / period.Seconds(),
+		last:     now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+	}
+}
+
+// Levels - Return the current level of all buckets
+func (l *RateLimiter) Levels() []BucketLevel {
+	l.Lock()
+	defer l.Unlock()
+
+	var levels []BucketLevel
+	now := l.now()
+	for _, class := range []RequestClass{RequestClassTrading, RequestClassNonTrading, RequestClassHistoricalPrices} {
+		bucket := l.buckets[class]
+		if bucket == nil {
+			continue
+		}
+		bucket.refill(now)
+		levels = append(levels, BucketLevel{Class: class, Available: bucket.tokens, Capacity: bucket.capacity})
+	}
+	return levels
+}
+
+// wait - Take cost tokens from the bucket of the given class
+func (l *RateLimiter) wait(ctx context.Context, class RequestClass, cost float64) error {
+	for {
+		l.Lock()
+		bucket := l.buckets[class]
+		if bucket == nil {
+			l.Unlock()
+			return nil
+		}
+		if cost > bucket.capacity {
+			cost = bucket.capacity
+		}
+		bucket.refill(l.now())
+		if bucket.tokens >= cost {
+			bucket.tokens -= cost
+			l.Unlock()
+			return nil
+		}
+		delay := time.Duration((cost - bucket.tokens) / bucket.rate * float64(time.Second))
+		l.Unlock()
+
+		if l.policy == RateLimitFailFast {
+			return ErrClientRateLimited
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// exhaust - Empty the bucket after IG reported that the allowance has been exceeded
+func (l *RateLimiter) exhaust(class RequestClass) {
+	l.Lock()
+	defer l.Unlock()
+
+	if bucket := l.buckets[class]; bucket != nil {
+		bucket.tokens = 0
+		bucket.last = l.now()
+	}
+}
+
+// classifyRequest - Determine the allowance and the number of tokens a request consumes
+func classifyRequest(req *http.Request) (RequestClass, float64) {
+	path := req.URL.Path
+	if strings.Contains(path, "/gateway/deal/prices/") {
+		// Price history is counted in data points, IG returns 10 by default
+		if max, err := strconv.Atoi(req.URL.Query().Get("max")); err == nil && max > 0 {
+			return RequestClassHistoricalPrices, float64(max)
+		}
+		return RequestClassHistoricalPrices, 10
+	}
+
+	isDealing := strings.HasPrefix(path, "/gateway/deal/positions") || strings.HasPrefix(path, "/gateway/deal/workingorders")
+	if isDealing && (req.Method != http.MethodGet || req.Header.Get("_method") != "") {
+		return RequestClassTrading, 1
+	}
+
+	return RequestClassNonTrading, 1
+}
@@ -0,0 +1,138 @@
+package igmarkets
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy - Controls if and how failed requests are retried.
+// The zero value disables retries.
+type RetryPolicy struct {
+	MaxAttempts      int           // Total number of attempts incl. the first one; <= 1 disables retries
+	InitialBackoff   time.Duration // Delay before the first retry
+	MaxBackoff       time.Duration // Upper bound for the exponential backoff
+	Jitter           float64       // Fraction of the delay that is randomised, between 0 and 1
+	RateLimitBackoff time.Duration // Minimum delay after an allowance error without Retry-After header
+}
+
+// DefaultRetryPolicy - Retry up to three times with exponential backoff and jitter
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:      4,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       30 * time.Second,
+		Jitter:           0.5,
+		RateLimitBackoff: 10 * time.Second,
+	}
+}
+
+type idempotentRequestKey struct{}
+
+// withIdempotentRequest - Mark a non-GET request as safe to be sent more than once,
+// e.g. orders carrying their own dealReference.
+func withIdempotentRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentRequestKey{}, true)
+}
+
+// isIdempotentRequest - GET, PUT and DELETE are idempotent. POST requests (incl. the
+// "_method: DELETE" overrides) are only idempotent when marked by withIdempotentRequest().
+func isIdempotentRequest(ctx context.Context, req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return req.Header.Get("_method") == ""
+	}
+	marked, _ := ctx.Value(idempotentRequestKey{}).(bool)
+	return marked
+}
+
+// retryDelay - Decide whether the failed attempt should be retried and how long to wait before
+func (p RetryPolicy) retryDelay(ctx context.Context, req *http.Request, attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil || errors.Is(err, ErrClientRateLimited) {
+		return 0, false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case errors.Is(err, ErrHistoricalDataAllowanceExceeded):
+			// Allowance is renewed weekly, retrying makes no sense
+			return 0, false
+		case errors.Is(err, ErrRateLimited) || apiErr.StatusCode == http.StatusTooManyRequests:
+			// IG rejected the request without processing it, so it is safe to send it again
+			if apiErr.RetryAfter > 0 {
+				return apiErr.RetryAfter, true
+			}
+			if delay < p.RateLimitBackoff {
+				delay = p.RateLimitBackoff
+			}
+			return delay, true
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			if !isIdempotentRequest(ctx, req) {
+				return 0, false
+			}
+			if apiErr.RetryAfter > 0 {
+				return apiErr.RetryAfter, true
+			}
+			return delay, true
+		}
+		return 0, false
+	}
+
+	// Transport errors (connection reset, timeouts, ...)
+	if !isIdempotentRequest(ctx, req) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// backoff - Exponential backoff with jitter for the given attempt (starting at 1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay = delay*(1-jitter) + delay*jitter*rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// parseRetryAfter - Parse Retry-After header given in seconds or as HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// sleepContext - Wait for the given duration or until the context is done
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
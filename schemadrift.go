@@ -0,0 +1,372 @@
+package igmarkets
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SchemaDrift - Differences between a response payload and the struct it was decoded into
+type SchemaDrift struct {
+	Method         string   // e.g. "GET"
+	Endpoint       string   // Path with placeholders, see Request.Endpoint()
+	Version        int      // Endpoint version sent in the VERSION header
+	Type           string   // Go type of the response, e.g. "igmarkets.MarketsResponse"
+	UnknownFields  []string // JSON paths not present in the struct, e.g. "instrument.openingHours"
+	MissingFields  []string // Tagged struct fields not sent by IG, e.g. "activities[].metadata"
+	TypeMismatches []string // e.g. "snapshot.scalingFactor: string into float64"
+	UnknownValues  []string // Enum values unknown to the client, e.g. "status: SOMETHING_NEW"
+}
+
+// empty - True if the payload matched the struct
+func (d *SchemaDrift) empty() bool {
+	return len(d.UnknownFields) == 0 && len(d.MissingFields) == 0 && len(d.TypeMismatches) == 0 && len(d.UnknownValues) == 0
+}
+
+// SchemaDriftHandler - Receives the drift of a response, called synchronously after decoding
+type SchemaDriftHandler func(drift SchemaDrift)
+
+// WithStrictDecoding - Compare every response payload with the struct it is decoded into and pass
+// unknown fields, missing fields and type mismatches to the handler. Calls do not fail because of
+// a drift; fields with mismatching types keep their zero value. A nil handler logs a warning instead.
+func WithStrictDecoding(handler SchemaDriftHandler) Option {
+	return func(ig *IGMarkets) error {
+		ig.strictDecoding = true
+		ig.schemaDriftHandler = handler
+		return nil
+	}
+}
+
+// SchemaDriftReport - Collects the drifts of all responses per endpoint, e.g. for a report at the end of a test run
+type SchemaDriftReport struct {
+	mu     sync.Mutex
+	drifts map[string]*SchemaDrift // method endpoint version -> merged drift
+}
+
+// NewSchemaDriftReport - Create an empty report, pass its Record method to WithStrictDecoding()
+func NewSchemaDriftReport() *SchemaDriftReport {
+	return &SchemaDriftReport{drifts: make(map[string]*SchemaDrift)}
+}
+
+// Record - Merge the drift into the report
+func (r *SchemaDriftReport) Record(drift SchemaDrift) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := fmt.Sprintf("%s %s %d", drift.Method, drift.Endpoint, drift.Version)
+	merged, found := r.drifts[key]
+	if !found {
+		merged = &SchemaDrift{Method: drift.Method, Endpoint: drift.Endpoint, Version: drift.Version, Type: drift.Type}
+		r.drifts[key] = merged
+	}
+	merged.UnknownFields = mergeSorted(merged.UnknownFields, drift.UnknownFields)
+	merged.MissingFields = mergeSorted(merged.MissingFields, drift.MissingFields)
+	merged.TypeMismatches = mergeSorted(merged.TypeMismatches, drift.TypeMismatches)
+	merged.UnknownValues = mergeSorted(merged.UnknownValues, drift.UnknownValues)
+}
+
+// Drifts - Merged drift of every endpoint, sorted by endpoint
+func (r *SchemaDriftReport) Drifts() []SchemaDrift {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	drifts := make([]SchemaDrift, 0, len(r.drifts))
+	for _, drift := range r.drifts {
+		drifts = append(drifts, *drift)
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Endpoint != drifts[j].Endpoint {
+			return drifts[i].Endpoint < drifts[j].Endpoint
+		}
+		if drifts[i].Method != drifts[j].Method {
+			return drifts[i].Method < drifts[j].Method
+		}
+		return drifts[i].Version < drifts[j].Version
+	})
+	return drifts
+}
+
+// decodeStrict - Decode body into v and report the drift of the payload. Type mismatches and values
+// rejected by an UnmarshalJSON method do not fail, the affected fields keep their zero value.
+func (ig *IGMarkets) decodeStrict(req *Request, body []byte, v interface{}) error {
+	var payload interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return err
+	}
+
+	t := reflect.TypeOf(v).Elem()
+	drift := SchemaDrift{
+		Method:   req.Method,
+		Endpoint: req.Endpoint(),
+		Version:  req.Version,
+		Type:     t.String(),
+	}
+	seen := make(map[string]bool)
+	if compareSchema(&drift, seen, "", payload, t) {
+		payload = nil
+	}
+
+	err := json.Unmarshal(body, v)
+	if _, typeMismatch := err.(*json.UnmarshalTypeError); err != nil && !typeMismatch {
+		// Decode again without the values compareSchema() found invalid
+		sanitized, marshalErr := json.Marshal(payload)
+		if marshalErr != nil {
+			return err
+		}
+		reflect.ValueOf(v).Elem().Set(reflect.Zero(t))
+		err = json.Unmarshal(sanitized, v)
+	}
+	if _, typeMismatch := err.(*json.UnmarshalTypeError); err != nil && !typeMismatch {
+		return err
+	}
+
+	if drift.empty() {
+		return nil
+	}
+	sort.Strings(drift.UnknownFields)
+	sort.Strings(drift.MissingFields)
+	sort.Strings(drift.TypeMismatches)
+	sort.Strings(drift.UnknownValues)
+
+	if ig.schemaDriftHandler != nil {
+		ig.schemaDriftHandler(drift)
+		return nil
+	}
+	ig.log(logLevelWarn, "response does not match schema", "method", drift.Method, "endpoint", drift.Endpoint,
+		"version", drift.Version, "type", drift.Type, "unknownFields", drift.UnknownFields,
+		"missingFields", drift.MissingFields, "typeMismatches", drift.TypeMismatches, "unknownValues", drift.UnknownValues)
+	return nil
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	enumType            = reflect.TypeOf((*interface{ valid() bool })(nil)).Elem()
+)
+
+// compareSchema - Walk the payload along the type like encoding/json and record differences.
+// Slice elements share the path "name[]"; seen removes duplicates. Returns true if the value is
+// rejected by the UnmarshalJSON or UnmarshalText method of t and has to be removed before decoding.
+func compareSchema(drift *SchemaDrift, seen map[string]bool, path string, value interface{}, t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if value == nil {
+		return false
+	}
+
+	mismatch := func(jsonType string) {
+		entry := fmt.Sprintf("%s: %s into %s", displayPath(path), jsonType, t.String())
+		if !seen[entry] {
+			seen[entry] = true
+			drift.TypeMismatches = append(drift.TypeMismatches, entry)
+		}
+	}
+
+	switch {
+	case reflect.PtrTo(t).Implements(jsonUnmarshalerType):
+		decoded := reflect.New(t)
+		data, err := json.Marshal(value)
+		if err == nil {
+			err = decoded.Interface().(json.Unmarshaler).UnmarshalJSON(data)
+		}
+		if err != nil {
+			mismatch(jsonTypeName(value))
+			return true
+		}
+		if t.Implements(enumType) && decoded.Elem().String() != "" && !decoded.Elem().Interface().(interface{ valid() bool }).valid() {
+			appendOnce(&drift.UnknownValues, seen, "value "+displayPath(path)+" "+decoded.Elem().String(),
+				fmt.Sprintf("%s: %s", displayPath(path), decoded.Elem().String()))
+		}
+		return false
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		text, ok := value.(string)
+		if !ok || reflect.New(t).Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)) != nil {
+			mismatch(jsonTypeName(value))
+			return true
+		}
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch(jsonTypeName(value))
+			return false
+		}
+		fields := jsonFields(t)
+		matched := make(map[string]bool, len(fields))
+		for key, fieldValue := range object {
+			field, found := matchField(fields, key)
+			if !found {
+				appendOnce(&drift.UnknownFields, seen, "unknown "+joinPath(path, key), joinPath(path, key))
+				continue
+			}
+			matched[field.name] = true
+			if compareSchema(drift, seen, joinPath(path, key), fieldValue, field.typ) {
+				object[key] = nil
+			}
+		}
+		for _, field := range fields {
+			if field.tagged && !matched[field.name] {
+				appendOnce(&drift.MissingFields, seen, "missing "+joinPath(path, field.name), joinPath(path, field.name))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := value.([]interface{})
+		if !ok {
+			if _, isString := value.(string); isString && t.Elem().Kind() == reflect.Uint8 {
+				return false // []byte is sent base64 encoded
+			}
+			mismatch(jsonTypeName(value))
+			return false
+		}
+		for i, element := range array {
+			if compareSchema(drift, seen, path+"[]", element, t.Elem()) {
+				array[i] = nil
+			}
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch(jsonTypeName(value))
+			return false
+		}
+		for key, element := range object {
+			if compareSchema(drift, seen, path+"{}", element, t.Elem()) {
+				object[key] = nil
+			}
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			mismatch(jsonTypeName(value))
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			mismatch(jsonTypeName(value))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, ok := value.(json.Number)
+		if !ok {
+			mismatch(jsonTypeName(value))
+		} else if _, err := number.Int64(); err != nil {
+			mismatch("fractional number")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			mismatch(jsonTypeName(value))
+		}
+	}
+	return false
+}
+
+// jsonField - Struct field as seen by encoding/json
+type jsonField struct {
+	name   string
+	typ    reflect.Type
+	tagged bool
+}
+
+// jsonFields - Exported fields of t by JSON name, including fields of embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: field.Type, tagged: tag != ""})
+	}
+	return fields
+}
+
+// matchField - Exact match first, then case-insensitive like encoding/json
+func matchField(fields []jsonField, key string) (jsonField, bool) {
+	for _, field := range fields {
+		if field.name == key {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.name, key) {
+			return field, true
+		}
+	}
+	return jsonField{}, false
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func appendOnce(list *[]string, seen map[string]bool, key, entry string) {
+	if !seen[key] {
+		seen[key] = true
+		*list = append(*list, entry)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// mergeSorted - Sorted union of both lists
+func mergeSorted(a, b []string) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for _, s := range a {
+		set[s] = true
+	}
+	for _, s := range b {
+		set[s] = true
+	}
+	merged := make([]string, 0, len(set))
+	for s := range set {
+		merged = append(merged, s)
+	}
+	sort.Strings(merged)
+	return merged
+}
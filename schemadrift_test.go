@@ -0,0 +1,89 @@
+package igmarkets
+
+import (
+	"context"
+	"github.com/AMekss/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gateway/deal/history/activity":
+			_, _ = w.Write([]byte(`{"activities":[{"epic":"CS.D.EURUSD.CFD.IP","channel":"WEB","date":"2022-01-01","dealId":"D1",
+				"description":"","details":{},"period":"-","status":"ACCEPTED","type":"POSITION"}],
+				"metadata":{"paging":{"size":1,"next":null}}}`))
+		case "/gateway/deal/positions/":
+			_, _ = w.Write([]byte(`{"positions":[{"market":{"epic":"CS.D.EURUSD.CFD.IP"},
+				"position":{"dealId":"D2","direction":"SIDEWAYS","level":"abc","size":"1.5"}}]}`))
+		case "/gateway/deal/clientsentiment/EURUSD":
+			_, _ = w.Write([]byte(`{"longPositionPercentage":"60.5","shortPositionPercentage":39.5,"marketId":"EURUSD"}`))
+		}
+	}))
+	defer server.Close()
+
+	report := NewSchemaDriftReport()
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithStrictDecoding(report.Record))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	activities, err := igm.GetActivity(ctx, time.Now().Add(-time.Hour), time.Now())
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "D1", activities.Activities[0].DealID)
+
+	// Type mismatches do not fail the call, the other fields are decoded
+	sentiment, err := igm.GetClientSentiment(ctx, "EURUSD")
+	assert.NoError(t, err)
+	assert.EqualFloat64(t, 0, sentiment.LongPositionPercentage)
+	assert.EqualFloat64(t, 39.5, sentiment.ShortPositionPercentage)
+	_, err = igm.GetClientSentiment(ctx, "EURUSD")
+	assert.NoError(t, err)
+
+	// Values rejected by UnmarshalJSON methods are reported like type mismatches, unknown enum values are kept
+	positions, err := igm.GetPositions(ctx)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "D2", positions.Positions[0].Position.DealID)
+	assert.EqualStrings(t, "1.5", positions.Positions[0].Position.Size.String())
+	assert.False(t, positions.Positions[0].Position.Level.IsSet())
+	assert.EqualStrings(t, "SIDEWAYS", string(positions.Positions[0].Position.Direction))
+
+	drifts := report.Drifts()
+	assert.EqualInt(t, 3, len(drifts))
+
+	assert.EqualStrings(t, "/gateway/deal/clientsentiment/{id}", drifts[0].Endpoint)
+	assert.EqualStrings(t, "igmarkets.ClientSentimentResponse", drifts[0].Type)
+	assert.EqualInt(t, 1, len(drifts[0].UnknownFields))
+	assert.EqualStrings(t, "marketId", drifts[0].UnknownFields[0])
+	assert.EqualInt(t, 1, len(drifts[0].TypeMismatches))
+	assert.EqualStrings(t, "longPositionPercentage: string into float64", drifts[0].TypeMismatches[0])
+
+	assert.EqualStrings(t, "/gateway/deal/history/activity", drifts[1].Endpoint)
+	assert.EqualInt(t, 3, drifts[1].Version)
+	assert.EqualStrings(t, "metadata", drifts[1].UnknownFields[0])
+	assert.True(t, containsString(drifts[1].MissingFields, "activities[].metadata"))
+	assert.True(t, containsString(drifts[1].MissingFields, "activities[].details.currency"))
+	assert.EqualInt(t, 0, len(drifts[1].TypeMismatches))
+
+	assert.EqualStrings(t, "/gateway/deal/positions", drifts[2].Endpoint)
+	assert.True(t, containsString(drifts[2].TypeMismatches, "positions[].position.level: string into igmarkets.Decimal"))
+	assert.EqualInt(t, 1, len(drifts[2].UnknownValues))
+	assert.EqualStrings(t, "positions[].position.direction: SIDEWAYS", drifts[2].UnknownValues[0])
+
+	// Without strict mode type mismatches still fail
+	igm, err = NewWithOptions(WithBaseURL(server.URL))
+	assert.NoError(t, err)
+	_, err = igm.GetClientSentiment(ctx, "EURUSD")
+	assert.True(t, err != nil)
+}
+
+func containsString(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
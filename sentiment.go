@@ -22,7 +22,6 @@ func (ig *IGMarkets) GetClientSentiment(ctx context.Context, MarketID string) (*
 		return nil, fmt.Errorf("igmarkets: unable to create HTTP request for GetClientSentiment: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, ClientSentimentResponse{})
-	igResponse, _ := igResponseInterface.(*ClientSentimentResponse)
+	igResponse, err := do[ClientSentimentResponse](ctx, ig, req, 1)
 	return igResponse, err
 }
@@ -3,10 +3,15 @@ package igmarkets
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type refreshTokenRequest struct {
@@ -14,8 +19,15 @@ type refreshTokenRequest struct {
 }
 
 type authRequest struct {
-	Identifier string `json:"identifier"`
-	Password   string `json:"password"`
+	Identifier        string `json:"identifier"`
+	Password          string `json:"password"`
+	EncryptedPassword bool   `json:"encryptedPassword,omitempty"`
+}
+
+// EncryptionKey - Response of GET /session/encryptionKey
+type EncryptionKey struct {
+	EncryptionKey string `json:"encryptionKey"` // Base64 encoded RSA public key
+	TimeStamp     int64  `json:"timeStamp"`
 }
 
 // session - IG auth response (OAuth only)
@@ -59,6 +71,10 @@ type OAuthToken struct {
 
 // RefreshToken - Get new OAuthToken from API and set it to IGMarkets object
 func (ig *IGMarkets) RefreshToken(ctx context.Context) error {
+	if ig.AuthMode == AuthModeSessionTokens {
+		return fmt.Errorf("igmarkets: session tokens cannot be refreshed, use Login() instead")
+	}
+
 	bodyReq := new(bytes.Buffer)
 
 	var authReq = refreshTokenRequest{
@@ -74,11 +90,12 @@ func (ig *IGMarkets) RefreshToken(ctx context.Context) error {
 		return fmt.Errorf("igmarkets: unable to send HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, OAuthToken{})
+	// Refreshing must not trigger another re-authentication if the refresh token is invalid as well
+	ctx = withoutReauthentication(withIdempotentRequest(ctx))
+	oauthToken, err := do[OAuthToken](ctx, ig, req, 1)
 	if err != nil {
 		return err
 	}
-	oauthToken, _ := igResponseInterface.(*OAuthToken)
 
 	if oauthToken.AccessToken == "" {
 		return fmt.Errorf("igmarkets: got response but access token is empty")
@@ -96,18 +113,39 @@ func (ig *IGMarkets) RefreshToken(ctx context.Context) error {
 
 	ig.Lock()
 	ig.OAuthToken = *oauthToken
+	ig.setTokenExpiry(expiry)
 	ig.Unlock()
 
+	ig.emitSessionEvent(SessionStateRefreshed, nil)
+	ig.saveSession(ctx)
+
 	return nil
 }
 
-// Login - Get new OAuthToken from API and set it to IGMarkets object
+// Login - Get new OAuthToken from API and set it to IGMarkets object.
+// With AuthModeSessionTokens the CST and XST tokens of LoginVersion2() are set instead.
 func (ig *IGMarkets) Login(ctx context.Context) error {
+	// A fresh instance reuses the session of a previous process if still valid
+	ig.RLock()
+	loggedIn := ig.currentToken() != ""
+	ig.RUnlock()
+	if !loggedIn && ig.restoreSession(ctx) {
+		return nil
+	}
+
+	if ig.AuthMode == AuthModeSessionTokens {
+		if _, err := ig.LoginVersion2(ctx); err != nil {
+			return err
+		}
+		ig.saveSession(ctx)
+		return nil
+	}
+
 	bodyReq := new(bytes.Buffer)
 
-	var authReq = authRequest{
-		Identifier: ig.Identifier,
-		Password:   ig.Password,
+	authReq, err := ig.newAuthRequest(ctx)
+	if err != nil {
+		return err
 	}
 
 	if err := json.NewEncoder(bodyReq).Encode(authReq); err != nil {
@@ -119,11 +157,10 @@ func (ig *IGMarkets) Login(ctx context.Context) error {
 		return fmt.Errorf("igmarkets: unable to send HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequestWithoutOAuth(ctx, req, 3, session{})
+	session, err := doWithoutOAuth[session](withIdempotentRequest(ctx), ig, req, 3)
 	if err != nil {
 		return err
 	}
-	session, _ := igResponseInterface.(*session)
 
 	if session.OAuthToken.AccessToken == "" {
 		return fmt.Errorf("igmarkets: got response but access token is empty")
@@ -141,9 +178,13 @@ func (ig *IGMarkets) Login(ctx context.Context) error {
 
 	ig.Lock()
 	ig.OAuthToken = session.OAuthToken
+	ig.setTokenExpiry(expiry)
 	ig.TimeZone = timeZoneOffset2Location(session.TimezoneOffset)
 	ig.Unlock()
 
+	ig.emitSessionEvent(SessionStateLoggedIn, nil)
+	ig.saveSession(ctx)
+
 	return nil
 }
 
@@ -151,9 +192,9 @@ func (ig *IGMarkets) Login(ctx context.Context) error {
 func (ig *IGMarkets) LoginVersion2(ctx context.Context) (*SessionVersion2, error) {
 	bodyReq := new(bytes.Buffer)
 
-	var authReq = authRequest{
-		Identifier: ig.Identifier,
-		Password:   ig.Password,
+	authReq, err := ig.newAuthRequest(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := json.NewEncoder(bodyReq).Encode(authReq); err != nil {
@@ -165,14 +206,207 @@ func (ig *IGMarkets) LoginVersion2(ctx context.Context) (*SessionVersion2, error
 		return nil, fmt.Errorf("igmarkets: unable to send HTTP request: %v", err)
 	}
 
-	igResponseInterface, headers, err := ig.doRequestWithResponseHeaders(ctx, req, 2, SessionVersion2{}, false)
+	session, headers, err := doWithResponseHeaders[SessionVersion2](withIdempotentRequest(ctx), ig, req, 2, false)
 	if err != nil {
 		return nil, err
 	}
-	session, _ := igResponseInterface.(*SessionVersion2)
 	if headers != nil {
 		session.CSTToken = headers.Get("CST")
 		session.XSTToken = headers.Get("X-SECURITY-TOKEN")
 	}
+
+	if session.CSTToken == "" || session.XSTToken == "" {
+		return nil, fmt.Errorf("igmarkets: got response but CST or X-SECURITY-TOKEN header is empty")
+	}
+
+	ig.Lock()
+	ig.setSessionTokens(session.CSTToken, session.XSTToken)
+	if ig.AuthMode == AuthModeSessionTokens {
+		ig.TimeZone = timeZoneOffset2Location(session.TimezoneOffset)
+	}
+	ig.Unlock()
+
+	if ig.AuthMode == AuthModeSessionTokens {
+		ig.emitSessionEvent(SessionStateLoggedIn, nil)
+	}
+
 	return session, nil
 }
+
+// SessionDetails - Response of GET /session
+type SessionDetails struct {
+	ClientID              string `json:"clientId"`
+	AccountID             string `json:"accountId"`
+	TimezoneOffset        int    `json:"timezoneOffset"` // In hours
+	Locale                string `json:"locale"`
+	Currency              string `json:"currency"`
+	LightstreamerEndpoint string `json:"lightstreamerEndpoint"`
+
+	// Extracted from HTTP Header if fetchSessionTokens is set
+	CSTToken string
+	XSTToken string
+}
+
+type switchAccountRequest struct {
+	AccountID      string `json:"accountId"`
+	DefaultAccount bool   `json:"defaultAccount"`
+}
+
+// SwitchAccountResponse - Response of PUT /session
+type SwitchAccountResponse struct {
+	TrailingStopsEnabled  bool `json:"trailingStopsEnabled"`
+	DealingEnabled        bool `json:"dealingEnabled"`
+	HasActiveDemoAccounts bool `json:"hasActiveDemoAccounts"`
+	HasActiveLiveAccounts bool `json:"hasActiveLiveAccounts"`
+}
+
+// GetSessionDetails - Returns the details of the current session.
+// fetchSessionTokens: also return CST and X-SECURITY-TOKEN, e.g. for LightStreamer when logged in via OAuth
+func (ig *IGMarkets) GetSessionDetails(ctx context.Context, fetchSessionTokens bool) (*SessionDetails, error) {
+	bodyReq := new(bytes.Buffer)
+
+	url := fmt.Sprintf("%s/gateway/deal/session?fetchSessionTokens=%t", ig.APIURL, fetchSessionTokens)
+	req, err := http.NewRequest("GET", url, bodyReq)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
+	}
+
+	details, headers, err := doWithResponseHeaders[SessionDetails](ctx, ig, req, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	if fetchSessionTokens && headers != nil {
+		details.CSTToken = headers.Get("CST")
+		details.XSTToken = headers.Get("X-SECURITY-TOKEN")
+	}
+
+	return details, nil
+}
+
+// Logout - Close the current session and forget all tokens. A running session keeper is stopped.
+func (ig *IGMarkets) Logout(ctx context.Context) error {
+	bodyReq := new(bytes.Buffer)
+
+	req, err := http.NewRequest("DELETE", ig.APIURL+"/gateway/deal/session", bodyReq)
+	if err != nil {
+		return fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
+	}
+
+	if err := ig.doWithoutResponse(withoutReauthentication(ctx), req, 1); err != nil {
+		return err
+	}
+
+	ig.Lock()
+	cancelSessionKeeper := ig.cancelSessionKeeper
+	ig.OAuthToken = OAuthToken{}
+	ig.tokenExpiry = time.Time{}
+	ig.CSTToken = ""
+	ig.XSTToken = ""
+	ig.Unlock()
+
+	ig.emitSessionEvent(SessionStateLoggedOut, nil)
+	ig.clearSession(ctx)
+	if cancelSessionKeeper != nil {
+		cancelSessionKeeper()
+	}
+
+	return nil
+}
+
+// SwitchAccount - Switch the session to another account returned by GetAccounts()
+// defaultAccount: use the account as default for future logins
+func (ig *IGMarkets) SwitchAccount(ctx context.Context, accountID string, defaultAccount bool) (*SwitchAccountResponse, error) {
+	bodyReq, err := json.Marshal(&switchAccountRequest{
+		AccountID:      accountID,
+		DefaultAccount: defaultAccount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: cannot marshal: %v", err)
+	}
+
+	req, err := http.NewRequest("PUT", ig.APIURL+"/gateway/deal/session", bytes.NewReader(bodyReq))
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
+	}
+
+	igResponse, err := do[SwitchAccountResponse](ctx, ig, req, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	ig.Lock()
+	ig.AccountID = accountID
+	ig.Unlock()
+
+	ig.saveSession(ctx)
+
+	return igResponse, nil
+}
+
+// GetEncryptionKey - Returns the RSA public key and time stamp for encrypting the password
+func (ig *IGMarkets) GetEncryptionKey(ctx context.Context) (*EncryptionKey, error) {
+	bodyReq := new(bytes.Buffer)
+
+	req, err := http.NewRequest("GET", ig.APIURL+"/gateway/deal/session/encryptionKey", bodyReq)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
+	}
+
+	encryptionKey, err := doWithoutOAuth[EncryptionKey](ctx, ig, req, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptionKey, nil
+}
+
+// newAuthRequest - Build login request, with encrypted password if EncryptPassword is set
+func (ig *IGMarkets) newAuthRequest(ctx context.Context) (*authRequest, error) {
+	if !ig.EncryptPassword {
+		return &authRequest{
+			Identifier: ig.Identifier,
+			Password:   ig.Password,
+		}, nil
+	}
+
+	encryptionKey, err := ig.GetEncryptionKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedPassword, err := encryptPassword(ig.Password, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authRequest{
+		Identifier:        ig.Identifier,
+		Password:          encryptedPassword,
+		EncryptedPassword: true,
+	}, nil
+}
+
+// encryptPassword - RSA PKCS#1 v1.5 encryption of base64(password|timestamp), base64 encoded
+func encryptPassword(password string, encryptionKey *EncryptionKey) (string, error) {
+	der, err := base64.StdEncoding.DecodeString(encryptionKey.EncryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("igmarkets: unable to decode encryption key: %v", err)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return "", fmt.Errorf("igmarkets: unable to parse encryption key: %v", err)
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("igmarkets: encryption key is not a RSA public key but %T", publicKey)
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", password, encryptionKey.TimeStamp)))
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, rsaPublicKey, []byte(input))
+	if err != nil {
+		return "", fmt.Errorf("igmarkets: unable to encrypt password: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
@@ -0,0 +1,135 @@
+package igmarkets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/AMekss/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoginWithEncryptedPassword(t *testing.T) {
+	const timeStamp = 1600000000000
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+
+	var loginRequest authRequest
+	var decryptedPassword string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gateway/deal/session/encryptionKey":
+			_ = json.NewEncoder(w).Encode(EncryptionKey{
+				EncryptionKey: base64.StdEncoding.EncodeToString(der),
+				TimeStamp:     timeStamp,
+			})
+		case "/gateway/deal/session":
+			_ = json.NewDecoder(r.Body).Decode(&loginRequest)
+			encrypted, _ := base64.StdEncoding.DecodeString(loginRequest.Password)
+			decrypted, _ := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encrypted)
+			plain, _ := base64.StdEncoding.DecodeString(string(decrypted))
+			decryptedPassword = string(plain)
+			_, _ = w.Write([]byte(`{"oauthToken":{"access_token":"TOKEN","refresh_token":"REFRESH","expires_in":"60"}}`))
+		}
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithCredentials("KEY", "user", "secret"), WithEncryptedPassword())
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(context.Background()))
+
+	assert.True(t, loginRequest.EncryptedPassword)
+	assert.EqualStrings(t, "user", loginRequest.Identifier)
+	assert.EqualStrings(t, fmt.Sprintf("secret|%d", timeStamp), decryptedPassword)
+	assert.EqualStrings(t, "TOKEN", igm.OAuthToken.AccessToken)
+}
+
+func TestEncryptPasswordInvalidKey(t *testing.T) {
+	_, err := encryptPassword("secret", &EncryptionKey{EncryptionKey: "not base64!"})
+	assert.True(t, err != nil)
+}
+
+func TestLoginReusesStoredSession(t *testing.T) {
+	var logins int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		_, _ = w.Write([]byte(`{"oauthToken":{"access_token":"TOKEN","refresh_token":"REFRESH","expires_in":"60"},"timezoneOffset":1}`))
+	}))
+	defer server.Close()
+
+	store, err := NewEncryptedFileSessionStore(filepath.Join(t.TempDir(), "session"), make([]byte, 32))
+	assert.NoError(t, err)
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithCredentials("KEY", "user", "secret"), WithSessionStore(store))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(context.Background()))
+	assert.EqualInt(t, 1, logins)
+
+	// Simulate restart of the process
+	igm, err = NewWithOptions(WithBaseURL(server.URL), WithCredentials("KEY", "user", "secret"), WithSessionStore(store))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(context.Background()))
+	assert.EqualInt(t, 1, logins)
+	assert.EqualStrings(t, "TOKEN", igm.OAuthToken.AccessToken)
+
+	// Sessions of other users are ignored
+	igm, err = NewWithOptions(WithBaseURL(server.URL), WithCredentials("KEY", "other", "secret"), WithSessionStore(store))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(context.Background()))
+	assert.EqualInt(t, 2, logins)
+}
+
+func TestLoginIgnoresStaleStoredSession(t *testing.T) {
+	var logins int
+	var accountHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accountHeaders = append(accountHeaders, r.Header.Get("IG-ACCOUNT-ID"))
+		if r.URL.Path == "/gateway/deal/session/refresh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errorCode":"error.security.invalid-details"}`))
+			return
+		}
+		logins++
+		_, _ = w.Write([]byte(`{"oauthToken":{"access_token":"NEW","refresh_token":"REFRESH","expires_in":"60"},"timezoneOffset":1}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store := NewFileSessionStore(filepath.Join(t.TempDir(), "session"))
+	stale := &StoredSession{APIURL: server.URL, Identifier: "user", AccountID: "STORED", AuthMode: AuthModeOAuth,
+		OAuthToken: OAuthToken{AccessToken: "OLD", RefreshToken: "EXPIRED"}, TokenExpiry: time.Now().Add(-time.Hour),
+		TimeZoneName: "STORED", TimeZoneOffset: 7200}
+	assert.NoError(t, store.Save(ctx, stale))
+
+	// Neither account, tokens nor time zone of the rejected session are kept
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithCredentials("KEY", "user", "secret"), WithSessionStore(store))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(ctx))
+	assert.EqualInt(t, 1, logins)
+	assert.EqualStrings(t, "", igm.AccountID)
+	assert.EqualStrings(t, "NEW", igm.OAuthToken.AccessToken)
+	name, _ := time.Now().In(igm.TimeZone).Zone()
+	assert.True(t, name != "STORED")
+	assert.EqualStrings(t, "", accountHeaders[len(accountHeaders)-1])
+
+	// A valid session of another account is not reused
+	stale.AccountID, stale.TokenExpiry = "OTHER", time.Now().Add(time.Hour)
+	assert.NoError(t, store.Save(ctx, stale))
+	igm, err = NewWithOptions(WithBaseURL(server.URL), WithCredentials("KEY", "user", "secret"), WithAccountID("ACCOUNT"),
+		WithSessionStore(store))
+	assert.NoError(t, err)
+	assert.NoError(t, igm.Login(ctx))
+	assert.EqualInt(t, 2, logins)
+	assert.EqualStrings(t, "ACCOUNT", igm.AccountID)
+	assert.EqualStrings(t, "ACCOUNT", accountHeaders[len(accountHeaders)-1])
+}
@@ -0,0 +1,231 @@
+package igmarkets
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SessionState - State of the session managed by KeepSession()
+type SessionState int
+
+const (
+	// SessionStateLoggedIn - Login() succeeded
+	SessionStateLoggedIn SessionState = iota
+	// SessionStateRefreshed - RefreshToken() succeeded
+	SessionStateRefreshed
+	// SessionStateRefreshFailed - RefreshToken() failed, falling back to Login()
+	SessionStateRefreshFailed
+	// SessionStateLoginFailed - Login() failed, the session is lost until the next successful login
+	SessionStateLoginFailed
+	// SessionStateLoggedOut - Logout() succeeded
+	SessionStateLoggedOut
+)
+
+func (s SessionState) String() string {
+	switch s {
+	case SessionStateLoggedIn:
+		return "logged_in"
+	case SessionStateRefreshed:
+		return "refreshed"
+	case SessionStateRefreshFailed:
+		return "refresh_failed"
+	case SessionStateLoginFailed:
+		return "login_failed"
+	case SessionStateLoggedOut:
+		return "logged_out"
+	default:
+		return fmt.Sprintf("SessionState(%d)", int(s))
+	}
+}
+
+// SessionEvent - Session state change sent by KeepSession()
+type SessionEvent struct {
+	State SessionState
+	Time  time.Time
+	Err   error // Set for failed states
+}
+
+const (
+	// sessionEventBuffer - Events are dropped if the receiver falls behind
+	sessionEventBuffer = 16
+	// sessionRetryInterval - Delay between login attempts once the session is lost
+	sessionRetryInterval = 10 * time.Second
+	// minSessionRefreshMargin - Refresh at least this long before the token expires
+	minSessionRefreshMargin = 2 * time.Second
+)
+
+type reauthenticationKey struct{}
+
+// withoutReauthentication - Prevent renewing the session when the request fails with ErrTokenInvalid
+func withoutReauthentication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reauthenticationKey{}, false)
+}
+
+// KeepSession - Log in (if not done yet) and renew the OAuth token in the background before it expires
+// until the context is done. Falls back to Login() if RefreshToken() fails. With AuthModeSessionTokens
+// it logs in again before the CST/XST tokens expire. While the session keeper is running, requests
+// failing with ErrTokenInvalid are sent once more after renewing the session.
+// State changes are sent to the returned channel, which is closed when the context is done.
+func (ig *IGMarkets) KeepSession(ctx context.Context) (<-chan SessionEvent, error) {
+	events := make(chan SessionEvent, sessionEventBuffer)
+	ctx, cancel := context.WithCancel(ctx)
+
+	ig.Lock()
+	if ig.keepSession {
+		ig.Unlock()
+		cancel()
+		return nil, fmt.Errorf("igmarkets: session keeper is already running")
+	}
+	ig.keepSession = true
+	ig.sessionEvents = events
+	ig.cancelSessionKeeper = cancel
+	loggedIn := ig.currentToken() != ""
+	ig.Unlock()
+
+	if !loggedIn {
+		if err := ig.Login(ctx); err != nil {
+			ig.stopSessionKeeper()
+			cancel()
+			return nil, err
+		}
+	}
+
+	go ig.runSessionKeeper(ctx)
+
+	return events, nil
+}
+
+func (ig *IGMarkets) runSessionKeeper(ctx context.Context) {
+	defer ig.stopSessionKeeper()
+
+	for {
+		// Requests may have extended the session while sleeping, so the delay is checked again after waking up
+		if delay := ig.nextSessionRenewal(); delay > 0 {
+			if err := sleepContext(ctx, delay); err != nil {
+				return
+			}
+			continue
+		}
+
+		if err := ig.renewSession(ctx); err != nil {
+			ig.log(logLevelError, "renewing session failed", "error", err)
+			if err := sleepContext(ctx, sessionRetryInterval); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (ig *IGMarkets) stopSessionKeeper() {
+	ig.Lock()
+	defer ig.Unlock()
+
+	if ig.sessionEvents != nil {
+		close(ig.sessionEvents)
+	}
+	ig.sessionEvents = nil
+	ig.keepSession = false
+	ig.cancelSessionKeeper = nil
+}
+
+// nextSessionRenewal - Duration until the token should be renewed
+func (ig *IGMarkets) nextSessionRenewal() time.Duration {
+	ig.RLock()
+	defer ig.RUnlock()
+
+	if ig.AuthMode == AuthModeSessionTokens {
+		if ig.CSTToken == "" {
+			return 0
+		}
+		if delay := time.Until(ig.sessionTokenExpiry().Add(-sessionTokenRenewalMargin)); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+
+	if ig.tokenExpiry.IsZero() {
+		return 0
+	}
+
+	margin := ig.tokenLifetime / 4
+	if margin < minSessionRefreshMargin {
+		margin = minSessionRefreshMargin
+	}
+	if delay := time.Until(ig.tokenExpiry.Add(-margin)); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// renewSession - Refresh the token or log in again if refreshing fails
+func (ig *IGMarkets) renewSession(ctx context.Context) error {
+	if ig.AuthMode == AuthModeSessionTokens {
+		// Session tokens cannot be refreshed
+		if err := ig.Login(ctx); err != nil {
+			ig.emitSessionEvent(SessionStateLoginFailed, err)
+			return err
+		}
+		return nil
+	}
+
+	if err := ig.RefreshToken(ctx); err != nil {
+		ig.emitSessionEvent(SessionStateRefreshFailed, err)
+		if err := ig.Login(ctx); err != nil {
+			ig.emitSessionEvent(SessionStateLoginFailed, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// reauthenticationEnabled - Whether a request failing with ErrTokenInvalid should renew the session
+func (ig *IGMarkets) reauthenticationEnabled(ctx context.Context) bool {
+	if enabled, found := ctx.Value(reauthenticationKey{}).(bool); found && !enabled {
+		return false
+	}
+
+	ig.RLock()
+	defer ig.RUnlock()
+	return ig.keepSession
+}
+
+// reauthenticate - Renew the session after a request was rejected with the given token.
+// Concurrent callers wait for the first one and skip renewing if the token changed meanwhile.
+func (ig *IGMarkets) reauthenticate(ctx context.Context, rejectedToken string) error {
+	ig.reauthMutex.Lock()
+	defer ig.reauthMutex.Unlock()
+
+	ig.RLock()
+	renewed := ig.currentToken() != rejectedToken
+	ig.RUnlock()
+	if renewed {
+		return nil
+	}
+
+	return ig.renewSession(ctx)
+}
+
+// setTokenExpiry - Remember when the current token expires; caller must hold the lock
+func (ig *IGMarkets) setTokenExpiry(expiresInSeconds int64) {
+	ig.tokenLifetime = time.Duration(expiresInSeconds) * time.Second
+	ig.tokenExpiry = time.Now().Add(ig.tokenLifetime)
+}
+
+// emitSessionEvent - Send event to the observers and the session keeper's channel without blocking
+func (ig *IGMarkets) emitSessionEvent(state SessionState, err error) {
+	event := SessionEvent{State: state, Time: time.Now(), Err: err}
+	ig.observeSession(event)
+
+	ig.RLock()
+	defer ig.RUnlock()
+
+	if ig.sessionEvents == nil {
+		return
+	}
+
+	select {
+	case ig.sessionEvents <- event:
+	default:
+	}
+}
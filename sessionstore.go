@@ -0,0 +1,260 @@
+package igmarkets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StoredSession - Session data persisted by a SessionStore
+type StoredSession struct {
+	APIURL          string     `json:"apiUrl"`
+	Identifier      string     `json:"identifier"`
+	AccountID       string     `json:"accountId"`
+	AuthMode        AuthMode   `json:"authMode"`
+	OAuthToken      OAuthToken `json:"oauthToken"`
+	TokenExpiry     time.Time  `json:"tokenExpiry"`
+	CSTToken        string     `json:"cstToken"`
+	XSTToken        string     `json:"xstToken"`
+	SessionCreated  time.Time  `json:"sessionCreated"`
+	SessionLastUsed time.Time  `json:"sessionLastUsed"`
+	TimeZoneName    string     `json:"timeZoneName"`
+	TimeZoneOffset  int        `json:"timeZoneOffset"` // In seconds
+}
+
+// SessionStore - Persists the session so a restarted process can reuse it instead of logging in again
+type SessionStore interface {
+	// Load - Return the stored session or nil if there is none
+	Load(ctx context.Context) (*StoredSession, error)
+	Save(ctx context.Context, session *StoredSession) error
+	Clear(ctx context.Context) error
+}
+
+// WithSessionStore - Reuse a still valid session from the store on Login() and save new sessions to it
+func WithSessionStore(store SessionStore) Option {
+	return func(ig *IGMarkets) error {
+		ig.sessionStore = store
+		return nil
+	}
+}
+
+// FileSessionStore - SessionStore writing the session as JSON file, optionally AES-GCM encrypted
+type FileSessionStore struct {
+	path string
+	aead cipher.AEAD
+}
+
+// NewFileSessionStore - Store the session in plain text at the given path
+func NewFileSessionStore(path string) *FileSessionStore {
+	return &FileSessionStore{path: path}
+}
+
+// NewEncryptedFileSessionStore - Store the session AES-GCM encrypted at the given path.
+// key must be 16, 24 or 32 bytes long.
+func NewEncryptedFileSessionStore(path string, key []byte) (*FileSessionStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: invalid session store key: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to create AES-GCM cipher: %v", err)
+	}
+	return &FileSessionStore{path: path, aead: aead}, nil
+}
+
+// Load - Read session from file
+func (s *FileSessionStore) Load(_ context.Context) (*StoredSession, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to read session file: %v", err)
+	}
+
+	if s.aead != nil {
+		nonceSize := s.aead.NonceSize()
+		if len(data) < nonceSize {
+			return nil, fmt.Errorf("igmarkets: session file is too short")
+		}
+		data, err = s.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("igmarkets: unable to decrypt session file: %v", err)
+		}
+	}
+
+	var session StoredSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to unmarshal session file: %v", err)
+	}
+	return &session, nil
+}
+
+// Save - Write session to file, readable by the current user only
+func (s *FileSessionStore) Save(_ context.Context, session *StoredSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("igmarkets: cannot marshal: %v", err)
+	}
+
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return fmt.Errorf("igmarkets: unable to create nonce: %v", err)
+		}
+		data = s.aead.Seal(nonce, nonce, data, nil)
+	}
+
+	// Write to temporary file first so a crash never leaves a truncated session file behind
+	tmpFile, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("igmarkets: unable to create session file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("igmarkets: unable to write session file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("igmarkets: unable to write session file: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), s.path); err != nil {
+		return fmt.Errorf("igmarkets: unable to write session file: %v", err)
+	}
+	return nil
+}
+
+// Clear - Delete session file
+func (s *FileSessionStore) Clear(_ context.Context) error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("igmarkets: unable to delete session file: %v", err)
+	}
+	return nil
+}
+
+// restoreSession - Take over a still valid session from the session store.
+// An expired OAuth access token is refreshed if the stored refresh token still works.
+func (ig *IGMarkets) restoreSession(ctx context.Context) bool {
+	if ig.sessionStore == nil {
+		return false
+	}
+
+	stored, err := ig.sessionStore.Load(ctx)
+	if err != nil {
+		ig.log(logLevelWarn, "loading session failed", "error", err)
+		return false
+	}
+	if stored == nil || stored.APIURL != ig.APIURL || stored.Identifier != ig.Identifier || stored.AuthMode != ig.AuthMode {
+		return false
+	}
+	// The stored account would be sent as IG-ACCOUNT-ID instead of the configured one
+	ig.RLock()
+	accountID := ig.AccountID
+	ig.RUnlock()
+	if accountID != "" && stored.AccountID != accountID {
+		return false
+	}
+
+	now := time.Now()
+	switch {
+	case ig.AuthMode == AuthModeSessionTokens:
+		expiry := sessionTokenExpiryOf(stored.SessionCreated, stored.SessionLastUsed)
+		if stored.CSTToken == "" || !now.Add(sessionTokenRenewalMargin).Before(expiry) {
+			return false
+		}
+	case stored.OAuthToken.AccessToken != "" && now.Add(minSessionRefreshMargin).Before(stored.TokenExpiry):
+	case stored.OAuthToken.RefreshToken != "":
+		// The refresh request is sent with the stored session, which is dropped again if the refresh fails
+		ig.RLock()
+		previous, previousTimeZone := ig.currentSession(), ig.TimeZone
+		ig.RUnlock()
+		ig.applySession(stored)
+		if err := ig.RefreshToken(ctx); err != nil {
+			ig.applySession(previous)
+			ig.Lock()
+			ig.TimeZone = previousTimeZone
+			ig.Unlock()
+			return false
+		}
+		return true
+	default:
+		return false
+	}
+
+	ig.applySession(stored)
+	ig.emitSessionEvent(SessionStateLoggedIn, nil)
+	return true
+}
+
+// applySession - Set account, tokens and time zone of the session
+func (ig *IGMarkets) applySession(session *StoredSession) {
+	ig.Lock()
+	defer ig.Unlock()
+	ig.AccountID = session.AccountID
+	ig.OAuthToken = session.OAuthToken
+	ig.tokenExpiry = session.TokenExpiry
+	ig.tokenLifetime = 0
+	ig.CSTToken = session.CSTToken
+	ig.XSTToken = session.XSTToken
+	ig.sessionCreated = session.SessionCreated
+	ig.sessionLastUsed = session.SessionLastUsed
+	if session.TimeZoneName != "" {
+		ig.TimeZone = time.FixedZone(session.TimeZoneName, session.TimeZoneOffset)
+	}
+}
+
+// currentSession - Session data of the client; caller must hold the lock
+func (ig *IGMarkets) currentSession() *StoredSession {
+	session := &StoredSession{
+		APIURL:          ig.APIURL,
+		Identifier:      ig.Identifier,
+		AccountID:       ig.AccountID,
+		AuthMode:        ig.AuthMode,
+		OAuthToken:      ig.OAuthToken,
+		TokenExpiry:     ig.tokenExpiry,
+		CSTToken:        ig.CSTToken,
+		XSTToken:        ig.XSTToken,
+		SessionCreated:  ig.sessionCreated,
+		SessionLastUsed: ig.sessionLastUsed,
+	}
+	if ig.TimeZone != nil {
+		session.TimeZoneName, session.TimeZoneOffset = time.Now().In(ig.TimeZone).Zone()
+	}
+	return session
+}
+
+// saveSession - Write the current session to the session store
+func (ig *IGMarkets) saveSession(ctx context.Context) {
+	if ig.sessionStore == nil {
+		return
+	}
+
+	ig.RLock()
+	stored := ig.currentSession()
+	ig.RUnlock()
+
+	if err := ig.sessionStore.Save(ctx, stored); err != nil {
+		ig.log(logLevelWarn, "saving session failed", "error", err)
+	}
+}
+
+// clearSession - Remove the session from the session store
+func (ig *IGMarkets) clearSession(ctx context.Context) {
+	if ig.sessionStore == nil {
+		return
+	}
+	if err := ig.sessionStore.Clear(ctx); err != nil {
+		ig.log(logLevelWarn, "clearing session failed", "error", err)
+	}
+}
@@ -0,0 +1,98 @@
+package igmarkets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AuthMode - How REST requests are authenticated
+type AuthMode int
+
+const (
+	// AuthModeOAuth - Send the OAuth access token from Login() (version 3). Tokens expire after about a minute.
+	AuthModeOAuth AuthMode = iota
+	// AuthModeSessionTokens - Send CST and X-SECURITY-TOKEN headers from LoginVersion2().
+	// Tokens are valid for 6 hours after the last request, but not longer than 72 hours.
+	AuthModeSessionTokens
+)
+
+const (
+	// sessionTokenIdleTimeout - CST/XST expire after 6 hours without requests
+	sessionTokenIdleTimeout = 6 * time.Hour
+	// sessionTokenMaxLifetime - CST/XST expire 72 hours after login at the latest
+	sessionTokenMaxLifetime = 72 * time.Hour
+	// sessionTokenRenewalMargin - Log in again this long before the session tokens expire
+	sessionTokenRenewalMargin = 5 * time.Minute
+)
+
+// WithAuthMode - Authenticate REST requests with OAuth (default) or CST/X-SECURITY-TOKEN session tokens
+func WithAuthMode(mode AuthMode) Option {
+	return func(ig *IGMarkets) error {
+		if mode != AuthModeOAuth && mode != AuthModeSessionTokens {
+			return fmt.Errorf("igmarkets: invalid auth mode %d", mode)
+		}
+		ig.AuthMode = mode
+		return nil
+	}
+}
+
+// setSessionTokens - Store CST and XST tokens from a login response; caller must hold the lock
+func (ig *IGMarkets) setSessionTokens(cst, xst string) {
+	now := time.Now()
+	ig.CSTToken = cst
+	ig.XSTToken = xst
+	ig.sessionCreated = now
+	ig.sessionLastUsed = now
+}
+
+// sessionTokenExpiry - When the session tokens expire unless another request is sent; caller must hold the lock
+func (ig *IGMarkets) sessionTokenExpiry() time.Time {
+	return sessionTokenExpiryOf(ig.sessionCreated, ig.sessionLastUsed)
+}
+
+// sessionTokenExpiryOf - Expiry of session tokens created and last used at the given times
+func sessionTokenExpiryOf(created, lastUsed time.Time) time.Time {
+	idleExpiry := lastUsed.Add(sessionTokenIdleTimeout)
+	maxExpiry := created.Add(sessionTokenMaxLifetime)
+	if idleExpiry.Before(maxExpiry) {
+		return idleExpiry
+	}
+	return maxExpiry
+}
+
+// ensureSessionTokens - Check the session tokens have not expired before sending a request.
+// Expired tokens are renewed when the session keeper is running.
+func (ig *IGMarkets) ensureSessionTokens(ctx context.Context) error {
+	ig.RLock()
+	cst := ig.CSTToken
+	expired := cst != "" && time.Now().After(ig.sessionTokenExpiry())
+	ig.RUnlock()
+
+	if !expired {
+		return nil
+	}
+	if ig.reauthenticationEnabled(ctx) {
+		return ig.reauthenticate(ctx, cst)
+	}
+	return fmt.Errorf("%w: session tokens expired", ErrTokenInvalid)
+}
+
+// updateSessionTokens - IG may return renewed tokens with any response; every successful request
+// extends the lifetime of the session.
+func (ig *IGMarkets) updateSessionTokens(header http.Header) {
+	ig.Lock()
+	defer ig.Unlock()
+
+	if ig.CSTToken == "" {
+		return
+	}
+	if cst := header.Get("CST"); cst != "" {
+		ig.CSTToken = cst
+	}
+	if xst := header.Get("X-SECURITY-TOKEN"); xst != "" {
+		ig.XSTToken = xst
+	}
+	ig.sessionLastUsed = time.Now()
+}
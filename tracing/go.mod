@@ -0,0 +1,23 @@
+module github.com/sklinkert/igmarkets/tracing
+
+go 1.21
+
+require (
+	github.com/AMekss/assert v0.0.0-20190715092210-758496b7ede5
+	github.com/sklinkert/igmarkets v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/lfritz/env v1.0.0 // indirect
+	github.com/sirupsen/logrus v1.9.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/sklinkert/igmarkets => ../
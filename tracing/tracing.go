@@ -0,0 +1,236 @@
+// Package tracing creates OpenTelemetry spans for the REST requests of igmarkets clients.
+// Spans carry the epic, deal reference, deal ID, direction and size of the call, so an order,
+// the polls of its deal confirmation and later requests for the deal can be correlated.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sklinkert/igmarkets"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const instrumentationName = "github.com/sklinkert/igmarkets/tracing"
+
+// maxBodySize - Larger request and response bodies are not inspected for attributes
+const maxBodySize = 64 << 10
+
+// Attribute keys set on the spans
+const (
+	AttributeEpic            = attribute.Key("ig.epic")
+	AttributeDealReference   = attribute.Key("ig.deal_reference")
+	AttributeDealID          = attribute.Key("ig.deal_id")
+	AttributeDirection       = attribute.Key("ig.direction")
+	AttributeSize            = attribute.Key("ig.size")
+	AttributeDealStatus      = attribute.Key("ig.deal_status")
+	AttributeReason          = attribute.Key("ig.reason")
+	AttributeEndpointVersion = attribute.Key("ig.endpoint_version")
+	AttributeErrorCode       = attribute.Key("ig.error_code")
+	attributeMethod          = attribute.Key("http.request.method")
+	attributeStatusCode      = attribute.Key("http.response.status_code")
+	attributePath            = attribute.Key("url.path")
+)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// Option - Configures Middleware()
+type Option func(c *config)
+
+// WithTracerProvider - Use the given provider instead of the global one
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithPropagator - Use the given propagator instead of the global one to inject the trace context into request headers
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+// Middleware - Create a client span for every attempt of a REST request as child of the span in the
+// context passed to the igmarkets method. Spans of successful requests end once the response is decoded.
+func Middleware(opts ...Option) igmarkets.Middleware {
+	c := config{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	tracer := c.tracerProvider.Tracer(instrumentationName)
+
+	return func(next igmarkets.Handler) igmarkets.Handler {
+		return func(ctx context.Context, req *igmarkets.Request) (*igmarkets.Response, error) {
+			attributes := []attribute.KeyValue{
+				attributeMethod.String(req.Method),
+				attributePath.String(req.Path),
+				AttributeEndpointVersion.Int(req.Version),
+			}
+			attributes = append(attributes, pathAttributes(req.Path)...)
+			attributes = append(attributes, requestAttributes(req)...)
+
+			ctx, span := tracer.Start(ctx, req.Method+" "+req.Endpoint(),
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+			c.propagator.Inject(ctx, propagation.HeaderCarrier(req.HTTPRequest.Header))
+
+			resp, err := next(ctx, req)
+			if resp != nil && resp.StatusCode != 0 {
+				span.SetAttributes(attributeStatusCode.Int(resp.StatusCode))
+			}
+			if err != nil {
+				var apiErr *igmarkets.APIError
+				if errors.As(err, &apiErr) && apiErr.ErrorCode != "" {
+					span.SetAttributes(AttributeErrorCode.String(apiErr.ErrorCode))
+				}
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				span.End()
+				return resp, err
+			}
+
+			if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+				span.End()
+				return resp, nil
+			}
+			resp.Body = &tracedBody{ReadCloser: resp.Body, span: span}
+			return resp, nil
+		}
+	}
+}
+
+// dealFields - Fields of IG requests and responses used as span attributes
+type dealFields struct {
+	Epic          string   `json:"epic"`
+	DealReference string   `json:"dealReference"`
+	DealID        string   `json:"dealId"`
+	Direction     string   `json:"direction"`
+	Size          *float64 `json:"size"`
+	DealStatus    string   `json:"dealStatus"`
+	Reason        string   `json:"reason"`
+}
+
+func (f *dealFields) attributes() []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	for key, value := range map[attribute.Key]string{
+		AttributeEpic:          f.Epic,
+		AttributeDealReference: f.DealReference,
+		AttributeDealID:        f.DealID,
+		AttributeDirection:     f.Direction,
+		AttributeDealStatus:    f.DealStatus,
+		AttributeReason:        f.Reason,
+	} {
+		if value != "" {
+			attributes = append(attributes, key.String(value))
+		}
+	}
+	if f.Size != nil {
+		attributes = append(attributes, AttributeSize.Float64(*f.Size))
+	}
+	return attributes
+}
+
+// parseDealFields - Extract attributes from a JSON body, ignoring bodies that are not JSON objects
+func parseDealFields(body []byte) []attribute.KeyValue {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return nil
+	}
+	var fields dealFields
+	// Fields of unexpected type are skipped, all others are still set
+	_ = json.Unmarshal(body, &fields)
+	return fields.attributes()
+}
+
+// requestAttributes - Attributes from the JSON request body, if it can be read again
+func requestAttributes(req *igmarkets.Request) []attribute.KeyValue {
+	if req.HTTPRequest.GetBody == nil || req.HTTPRequest.ContentLength > maxBodySize {
+		return nil
+	}
+	body, err := req.HTTPRequest.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return nil
+	}
+	return parseDealFields(data)
+}
+
+// pathAttributes - Epic, deal reference or deal ID contained in the path
+func pathAttributes(path string) []attribute.KeyValue {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, "/gateway/deal"), "/"), "/")
+	if len(segments) < 2 {
+		return nil
+	}
+
+	switch segments[0] {
+	case "markets", "prices":
+		return []attribute.KeyValue{AttributeEpic.String(segments[1])}
+	case "watchlists":
+		if len(segments) > 2 {
+			return []attribute.KeyValue{AttributeEpic.String(segments[2])}
+		}
+	case "confirms":
+		return []attribute.KeyValue{AttributeDealReference.String(segments[1])}
+	case "positions", "workingorders":
+		if segments[1] != "otc" {
+			return []attribute.KeyValue{AttributeDealID.String(segments[1])}
+		}
+		if len(segments) > 2 {
+			return []attribute.KeyValue{AttributeDealID.String(segments[2])}
+		}
+	}
+	return nil
+}
+
+// tracedBody - Response body recording deal attributes and ending the span once it is closed
+type tracedBody struct {
+	io.ReadCloser
+	span     trace.Span
+	buf      bytes.Buffer
+	overflow bool
+	once     sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if b.buf.Len()+n > maxBodySize {
+			b.overflow = true
+			b.buf.Reset()
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.once.Do(func() {
+		if !b.overflow {
+			b.span.SetAttributes(parseDealFields(b.buf.Bytes())...)
+		}
+		b.span.End()
+	})
+	return b.ReadCloser.Close()
+}
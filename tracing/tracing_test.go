@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"github.com/AMekss/assert"
+	"github.com/sklinkert/igmarkets"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gateway/deal/positions/otc":
+			_, _ = w.Write([]byte(`{"dealReference":"REF"}`))
+		case "/gateway/deal/confirms/REF":
+			_, _ = w.Write([]byte(`{"dealReference":"REF","dealId":"DEAL","dealStatus":"REJECTED","reason":"MARKET_CLOSED"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errorCode":"error.service.marketdata.position.details.null.error"}`))
+		}
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	igm, err := igmarkets.NewWithOptions(igmarkets.WithBaseURL(server.URL),
+		igmarkets.WithMiddleware(Middleware(WithTracerProvider(provider))))
+	assert.NoError(t, err)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "trade")
+	_, err = igm.PlaceOTCOrder(ctx, igmarkets.OTCOrderRequest{Epic: "CS.D.EURUSD.CFD.IP", Direction: "BUY", Size: igmarkets.DecimalFromFloat(1.5)})
+	assert.NoError(t, err)
+	_, err = igm.GetDealConfirmation(ctx, "REF")
+	assert.NoError(t, err)
+	_, err = igm.UpdateOTCOrder(ctx, "DEAL", igmarkets.OTCUpdateOrderRequest{StopLevel: igmarkets.DecimalFromFloat(1.1)})
+	assert.True(t, err != nil)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	assert.EqualInt(t, 4, len(spans))
+	for _, span := range spans[:3] {
+		assert.True(t, span.Parent.SpanID() == parent.SpanContext().SpanID())
+	}
+
+	order := attributes(spans[0].Attributes)
+	assert.EqualStrings(t, "POST /gateway/deal/positions/otc", spans[0].Name)
+	assert.EqualStrings(t, "CS.D.EURUSD.CFD.IP", order[AttributeEpic].AsString())
+	assert.EqualStrings(t, "BUY", order[AttributeDirection].AsString())
+	assert.EqualFloat64(t, 1.5, order[AttributeSize].AsFloat64())
+	assert.EqualStrings(t, "REF", order[AttributeDealReference].AsString())
+	assert.EqualInt(t, 2, int(order[AttributeEndpointVersion].AsInt64()))
+
+	confirmation := attributes(spans[1].Attributes)
+	assert.EqualStrings(t, "DEAL", confirmation[AttributeDealID].AsString())
+	assert.EqualStrings(t, "REJECTED", confirmation[AttributeDealStatus].AsString())
+	assert.EqualStrings(t, "MARKET_CLOSED", confirmation[AttributeReason].AsString())
+
+	position := attributes(spans[2].Attributes)
+	assert.EqualStrings(t, "DEAL", position[AttributeDealID].AsString())
+	assert.EqualStrings(t, "error.service.marketdata.position.details.null.error", position[AttributeErrorCode].AsString())
+	assert.True(t, spans[2].Status.Code == codes.Error)
+}
+
+func attributes(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
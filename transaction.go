@@ -23,19 +23,19 @@ type HistoryTransactionResponse struct {
 
 // Transaction - Part of HistoryTransactionResponse
 type Transaction struct {
-	CashTransaction bool   `json:"cashTransaction"`
-	CloseLevel      string `json:"closeLevel"`
-	Currency        string `json:"currency"`
-	Date            string `json:"date"`
-	DateUTC         string `json:"dateUtc"`
-	InstrumentName  string `json:"instrumentName"`
-	OpenDateUtc     string `json:"openDateUtc"`
-	OpenLevel       string `json:"openLevel"`
-	Period          string `json:"period"`
-	ProfitAndLoss   string `json:"profitAndLoss"`
-	Reference       string `json:"reference"`
-	Size            string `json:"size"`
-	TransactionType string `json:"transactionType"`
+	CashTransaction bool    `json:"cashTransaction"`
+	CloseLevel      Decimal `json:"closeLevel"`
+	Currency        string  `json:"currency"`
+	Date            string  `json:"date"`
+	DateUTC         string  `json:"dateUtc"`
+	InstrumentName  string  `json:"instrumentName"`
+	OpenDateUtc     string  `json:"openDateUtc"`
+	OpenLevel       Decimal `json:"openLevel"`
+	Period          string  `json:"period"`
+	ProfitAndLoss   Decimal `json:"profitAndLoss"`
+	Reference       string  `json:"reference"`
+	Size            Decimal `json:"size"`
+	TransactionType string  `json:"transactionType"`
 }
 
 // GetTransactions - Return all transaction
@@ -49,11 +49,10 @@ func (ig *IGMarkets) GetTransactions(ctx context.Context, transactionType string
 		return nil, fmt.Errorf("igmarkets: unable to get transactions: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 2, HistoryTransactionResponse{})
+	igResponse, err := do[HistoryTransactionResponse](ctx, ig, req, 2)
 	if err != nil {
 		return nil, err
 	}
-	igResponse, _ := igResponseInterface.(*HistoryTransactionResponse)
 
 	return igResponse, err
 }
@@ -0,0 +1,332 @@
+package igmarkets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Units of UnitValueFloat
+const (
+	UnitPoints     = "POINTS"
+	UnitPercentage = "PERCENTAGE"
+)
+
+// OrderViolation - Single violation of a dealing rule
+type OrderViolation struct {
+	Field   string // JSON field of the order, e.g. "stopDistance"
+	Rule    string // JSON field of DealingRules, e.g. "minNormalStopOrLimitDistance", empty for general checks
+	Message string // e.g. "2 is below the minimum of 5 points"
+}
+
+// OrderValidationError - All violations found by ValidateOTCOrder() or ValidateOTCWorkingOrder()
+type OrderValidationError struct {
+	Violations []OrderViolation
+}
+
+// Error - Implements the error interface
+func (e *OrderValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Field + ": " + violation.Message
+	}
+	return "igmarkets: order violates dealing rules: " + strings.Join(messages, "; ")
+}
+
+// Unwrap - Returns ErrInvalidOrder
+func (e *OrderValidationError) Unwrap() error {
+	return ErrInvalidOrder
+}
+
+// ValidateOTCOrder - Check the order against the dealing rules of its market and return an *OrderValidationError
+// listing every violation. level is the expected fill level (offer for BUY, bid for SELL orders); it converts stop and
+// limit levels as well as PERCENTAGE rules into points. Checks needing it are skipped if level is zero.
+func ValidateOTCOrder(order OTCOrderRequest, rules DealingRules, level Decimal) error {
+	var v violations
+	if order.Level.Sign() > 0 {
+		level = order.Level
+	}
+	if order.OrderType == OrderTypeMarket && rules.MarketOrderPreference == "NOT_AVAILABLE" {
+		v.add("orderType", "marketOrderPreference", "market orders are not available")
+	}
+	v.checkSize(order.Size, rules)
+	v.checkStopsAndLimits(stopsAndLimits{
+		direction:             order.Direction,
+		level:                 level,
+		stopLevel:             order.StopLevel,
+		stopDistance:          order.StopDistance,
+		limitLevel:            order.LimitLevel,
+		limitDistance:         order.LimitDistance,
+		guaranteedStop:        order.GuaranteedStop,
+		trailingStop:          order.TrailingStop,
+		trailingStopIncrement: order.TrailingStopIncrement,
+	}, rules)
+	return v.err()
+}
+
+// ValidateOTCWorkingOrder - Check the working order against the dealing rules of its market, see ValidateOTCOrder().
+// The order level is the reference for stop and limit levels and PERCENTAGE rules.
+func ValidateOTCWorkingOrder(order OTCWorkingOrderRequest, rules DealingRules) error {
+	var v violations
+	if order.Level.Sign() <= 0 {
+		v.add("level", "", "must be positive")
+	}
+	v.checkSize(order.Size, rules)
+	v.checkStopsAndLimits(stopsAndLimits{
+		direction:      order.Direction,
+		level:          order.Level,
+		stopLevel:      order.StopLevel,
+		stopDistance:   order.StopDistance,
+		limitLevel:     order.LimitLevel,
+		limitDistance:  order.LimitDistance,
+		guaranteedStop: order.GuaranteedStop,
+	}, rules)
+	return v.err()
+}
+
+// RoundOTCOrder - Round the size toward zero to the precision of MinDealSize and levels and distances to
+// decimalPlaces, e.g. Snapshot.DecimalPlacesFactor. The size is kept if the market has no MinDealSize.
+func RoundOTCOrder(order OTCOrderRequest, rules DealingRules, decimalPlaces int) OTCOrderRequest {
+	places := int32(decimalPlaces)
+	order.Size = roundSize(order.Size, rules)
+	order.Level = order.Level.Round(places)
+	order.StopLevel = order.StopLevel.Round(places)
+	order.StopDistance = order.StopDistance.Round(places)
+	order.LimitLevel = order.LimitLevel.Round(places)
+	order.LimitDistance = order.LimitDistance.Round(places)
+	order.TrailingStopIncrement = order.TrailingStopIncrement.Round(places)
+	return order
+}
+
+// RoundOTCWorkingOrder - Round the working order like RoundOTCOrder()
+func RoundOTCWorkingOrder(order OTCWorkingOrderRequest, rules DealingRules, decimalPlaces int) OTCWorkingOrderRequest {
+	places := int32(decimalPlaces)
+	order.Size = roundSize(order.Size, rules)
+	order.Level = order.Level.Round(places)
+	order.StopLevel = order.StopLevel.Round(places)
+	order.StopDistance = order.StopDistance.Round(places)
+	order.LimitLevel = order.LimitLevel.Round(places)
+	order.LimitDistance = order.LimitDistance.Round(places)
+	return order
+}
+
+// roundSize - Round the size toward zero to the precision of MinDealSize, so it is never enlarged.
+// Sizes below the minimum are left to ValidateOTCOrder(); the size is kept if the market has no MinDealSize.
+func roundSize(size Decimal, rules DealingRules) Decimal {
+	minimum := rules.MinDealSize.Value
+	if minimum.Sign() <= 0 {
+		return size
+	}
+	return size.Truncate(minimum.Places())
+}
+
+// OrderValidation - Pre-flight checks of PlaceOTCOrder() and PlaceOTCWorkingOrder(), see WithOrderValidation()
+type OrderValidation struct {
+	MarketCacheTTL time.Duration // How long the dealing rules of GetMarkets() are reused per epic, zero fetches them for every order
+	Round          bool          // Round size, levels and distances with RoundOTCOrder() before validating
+}
+
+// WithOrderValidation - Validate orders against the dealing rules of their market before they are sent to IG.
+// Invalid orders fail with an *OrderValidationError and are not sent.
+func WithOrderValidation(validation OrderValidation) Option {
+	return func(ig *IGMarkets) error {
+		ig.orderValidation = &orderValidator{validation: validation, markets: make(map[string]cachedMarket)}
+		return nil
+	}
+}
+
+// orderValidator - Pre-flight state of WithOrderValidation()
+type orderValidator struct {
+	validation OrderValidation
+	mu         sync.Mutex
+	markets    map[string]cachedMarket // epic -> market
+}
+
+type cachedMarket struct {
+	market  *MarketsResponse
+	fetched time.Time
+}
+
+// validationMarket - Cached or fresh GetMarkets() response of the epic
+func (ig *IGMarkets) validationMarket(ctx context.Context, epic string) (*MarketsResponse, error) {
+	validator := ig.orderValidation
+	validator.mu.Lock()
+	cached, found := validator.markets[epic]
+	validator.mu.Unlock()
+	if found && time.Since(cached.fetched) < validator.validation.MarketCacheTTL {
+		return cached.market, nil
+	}
+
+	market, err := ig.GetMarkets(ctx, epic)
+	if err != nil {
+		return nil, fmt.Errorf("igmarkets: unable to get dealing rules of %q: %w", epic, err)
+	}
+	validator.mu.Lock()
+	validator.markets[epic] = cachedMarket{market: market, fetched: time.Now()}
+	validator.mu.Unlock()
+	return market, nil
+}
+
+// preflightOTCOrder - Round and validate the order if WithOrderValidation() is set
+func (ig *IGMarkets) preflightOTCOrder(ctx context.Context, order OTCOrderRequest) (OTCOrderRequest, error) {
+	if ig.orderValidation == nil {
+		return order, nil
+	}
+	market, err := ig.validationMarket(ctx, order.Epic)
+	if err != nil {
+		return order, err
+	}
+
+	if ig.orderValidation.validation.Round {
+		order = RoundOTCOrder(order, market.DealingRules, int(market.Snapshot.DecimalPlacesFactor))
+	}
+	level := market.Snapshot.Offer
+	if order.Direction == DirectionSell {
+		level = market.Snapshot.Bid
+	}
+	return order, ValidateOTCOrder(order, market.DealingRules, level)
+}
+
+// preflightOTCWorkingOrder - Round and validate the working order if WithOrderValidation() is set
+func (ig *IGMarkets) preflightOTCWorkingOrder(ctx context.Context, order OTCWorkingOrderRequest) (OTCWorkingOrderRequest, error) {
+	if ig.orderValidation == nil {
+		return order, nil
+	}
+	market, err := ig.validationMarket(ctx, order.Epic)
+	if err != nil {
+		return order, err
+	}
+
+	if ig.orderValidation.validation.Round {
+		order = RoundOTCWorkingOrder(order, market.DealingRules, int(market.Snapshot.DecimalPlacesFactor))
+	}
+	return order, ValidateOTCWorkingOrder(order, market.DealingRules)
+}
+
+// stopsAndLimits - Fields shared by OTCOrderRequest and OTCWorkingOrderRequest
+type stopsAndLimits struct {
+	direction                 Direction
+	level                     Decimal
+	stopLevel, stopDistance   Decimal
+	limitLevel, limitDistance Decimal
+	guaranteedStop            bool
+	trailingStop              bool
+	trailingStopIncrement     Decimal
+}
+
+// violations - Collects the violations of an order
+type violations []OrderViolation
+
+func (v *violations) add(field, rule, format string, args ...interface{}) {
+	*v = append(*v, OrderViolation{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &OrderValidationError{Violations: v}
+}
+
+func (v *violations) checkSize(size Decimal, rules DealingRules) {
+	if size.Sign() <= 0 {
+		v.add("size", "", "must be positive")
+		return
+	}
+	if minimum := rules.MinDealSize.Value; size.Cmp(minimum) < 0 {
+		v.add("size", "minDealSize", "%v is below the minimum of %v", size, minimum)
+	}
+}
+
+func (v *violations) checkStopsAndLimits(order stopsAndLimits, rules DealingRules) {
+	// Stops are below BUY and above SELL positions, limits the other way round
+	below := order.direction != DirectionSell
+
+	stopRule, minStop := "minNormalStopOrLimitDistance", rules.MinNormalStopOrLimitDistance
+	if order.guaranteedStop {
+		stopRule, minStop = "minControlledRiskStopDistance", rules.MinControlledRiskStopDistance
+	}
+	v.checkDistance(order, "stopLevel", order.stopLevel, "stopDistance", order.stopDistance, below, stopRule, minStop, rules)
+	v.checkDistance(order, "limitLevel", order.limitLevel, "limitDistance", order.limitDistance, !below,
+		"minNormalStopOrLimitDistance", rules.MinNormalStopOrLimitDistance, rules)
+
+	if order.guaranteedStop && !order.stopLevel.IsSet() && !order.stopDistance.IsSet() {
+		v.add("guaranteedStop", "", "requires stopLevel or stopDistance")
+	}
+	if !order.trailingStop {
+		return
+	}
+	if rules.TrailingStopsPreference != "AVAILABLE" {
+		v.add("trailingStop", "trailingStopsPreference", "trailing stops are not available")
+	}
+	if order.guaranteedStop {
+		v.add("trailingStop", "", "guaranteed stops cannot trail")
+	}
+	if !order.stopDistance.IsSet() {
+		v.add("trailingStop", "", "requires stopDistance")
+	}
+	if !order.trailingStopIncrement.IsSet() {
+		v.add("trailingStopIncrement", "", "required for trailing stops")
+	} else if minStep, ok := inPoints(rules.MinStepDistance, order.level); ok && order.trailingStopIncrement.Cmp(minStep) < 0 {
+		v.add("trailingStopIncrement", "minStepDistance", "%v is below the minimum of %v points", order.trailingStopIncrement, minStep)
+	}
+}
+
+// checkDistance - Check the stop or limit given as level or distance; below is true if the level has to be below order.level
+func (v *violations) checkDistance(order stopsAndLimits, levelField string, level Decimal, distanceField string, distance Decimal,
+	below bool, minRule string, minDistance UnitValueFloat, rules DealingRules) {
+	if level.IsSet() && distance.IsSet() {
+		v.add(levelField, "", "only one of %s and %s may be set", levelField, distanceField)
+		return
+	}
+
+	field := distanceField
+	if distance.IsSet() && distance.Sign() <= 0 {
+		v.add(distanceField, "", "must be positive")
+		return
+	}
+	if level.IsSet() {
+		if order.level.Sign() <= 0 {
+			return
+		}
+		field = levelField
+		distance = level.Sub(order.level)
+		if below {
+			distance = distance.Neg()
+		}
+		if distance.Sign() <= 0 {
+			side := "above"
+			if below {
+				side = "below"
+			}
+			v.add(levelField, "", "%v must be %s the order level %v", level, side, order.level)
+			return
+		}
+	}
+	if !distance.IsSet() {
+		return
+	}
+
+	if minimum, known := inPoints(minDistance, order.level); known && distance.Cmp(minimum) < 0 {
+		v.add(field, minRule, "distance %v is below the minimum of %v points", distance, minimum)
+	}
+	if maximum, known := inPoints(rules.MaxStopOrLimitDistance, order.level); known && distance.Cmp(maximum) > 0 {
+		v.add(field, "maxStopOrLimitDistance", "distance %v is above the maximum of %v points", distance, maximum)
+	}
+}
+
+// inPoints - Rule value in points, PERCENTAGE rules are relative to level; false if unknown
+func inPoints(rule UnitValueFloat, level Decimal) (Decimal, bool) {
+	value := rule.Value
+	switch rule.Unit {
+	case UnitPercentage:
+		if level.Sign() <= 0 {
+			return Decimal{}, false
+		}
+		return value.Mul(level).Shift(-2), true
+	default:
+		return value, value.Sign() > 0
+	}
+}
@@ -0,0 +1,138 @@
+package igmarkets
+
+import (
+	"context"
+	"errors"
+	"github.com/AMekss/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testDealingRules() DealingRules {
+	return DealingRules{
+		MarketOrderPreference:         "AVAILABLE_DEFAULT_OFF",
+		TrailingStopsPreference:       "AVAILABLE",
+		MaxStopOrLimitDistance:        UnitValueFloat{Unit: UnitPercentage, Value: DecimalFromFloat(75)},
+		MinControlledRiskStopDistance: UnitValueFloat{Unit: UnitPoints, Value: DecimalFromFloat(40)},
+		MinDealSize:                   UnitValueFloat{Unit: UnitPoints, Value: DecimalFromFloat(0.5)},
+		MinNormalStopOrLimitDistance:  UnitValueFloat{Unit: UnitPoints, Value: DecimalFromFloat(8)},
+		MinStepDistance:               UnitValueFloat{Unit: UnitPoints, Value: DecimalFromFloat(1)},
+	}
+}
+
+func TestValidateOTCOrder(t *testing.T) {
+	rules := testDealingRules()
+
+	valid := OTCOrderRequest{Epic: "IX.D.DAX.IFD.IP", Direction: DirectionBuy, OrderType: OrderTypeMarket, Size: DecimalFromFloat(1),
+		StopDistance: DecimalFromFloat(10), LimitLevel: DecimalFromFloat(15020), TrailingStop: true, TrailingStopIncrement: DecimalFromFloat(1)}
+	assert.NoError(t, ValidateOTCOrder(valid, rules, DecimalFromFloat(15000)))
+
+	invalid := OTCOrderRequest{Epic: "IX.D.DAX.IFD.IP", Direction: DirectionSell, OrderType: OrderTypeMarket, Size: DecimalFromFloat(0.2),
+		StopDistance: DecimalFromFloat(20), GuaranteedStop: true, LimitLevel: DecimalFromFloat(15005), TrailingStop: true, TrailingStopIncrement: DecimalFromFloat(0.5)}
+	err := ValidateOTCOrder(invalid, rules, DecimalFromFloat(15000))
+	assert.True(t, errors.Is(err, ErrInvalidOrder))
+	var validationErr *OrderValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	rulesViolated := make([]string, 0, len(validationErr.Violations))
+	for _, violation := range validationErr.Violations {
+		rulesViolated = append(rulesViolated, violation.Field+"/"+violation.Rule)
+	}
+	assert.EqualInt(t, 5, len(rulesViolated))
+	assert.True(t, containsString(rulesViolated, "size/minDealSize"))
+	assert.True(t, containsString(rulesViolated, "stopDistance/minControlledRiskStopDistance"))
+	assert.True(t, containsString(rulesViolated, "limitLevel/"))   // Limit of a SELL order above the level
+	assert.True(t, containsString(rulesViolated, "trailingStop/")) // Guaranteed stops cannot trail
+	assert.True(t, containsString(rulesViolated, "trailingStopIncrement/minStepDistance"))
+
+	// Percentage rules are relative to the level
+	err = ValidateOTCOrder(OTCOrderRequest{Direction: DirectionBuy, Size: DecimalFromFloat(1), LimitDistance: DecimalFromFloat(800)}, rules, DecimalFromFloat(1000))
+	assert.True(t, errors.As(err, &validationErr))
+	assert.EqualInt(t, 1, len(validationErr.Violations))
+	assert.EqualStrings(t, "maxStopOrLimitDistance", validationErr.Violations[0].Rule)
+	assert.NoError(t, ValidateOTCOrder(OTCOrderRequest{Direction: DirectionBuy, Size: DecimalFromFloat(1), LimitDistance: DecimalFromFloat(800)}, rules, Decimal{}))
+
+	rules.MarketOrderPreference = "NOT_AVAILABLE"
+	rules.TrailingStopsPreference = "NOT_AVAILABLE"
+	err = ValidateOTCOrder(valid, rules, DecimalFromFloat(15000))
+	assert.True(t, errors.As(err, &validationErr))
+	assert.EqualInt(t, 2, len(validationErr.Violations))
+}
+
+func TestValidateOTCWorkingOrder(t *testing.T) {
+	rules := testDealingRules()
+	order := OTCWorkingOrderRequest{Epic: "IX.D.DAX.IFD.IP", Direction: DirectionBuy, Type: WorkingOrderTypeLimit,
+		Size: DecimalFromFloat(1), Level: DecimalFromFloat(14000), StopLevel: DecimalFromFloat(13995), LimitDistance: DecimalFromFloat(9)}
+	err := ValidateOTCWorkingOrder(order, rules)
+	var validationErr *OrderValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.EqualInt(t, 1, len(validationErr.Violations))
+	assert.EqualStrings(t, "stopLevel", validationErr.Violations[0].Field)
+	assert.EqualStrings(t, "minNormalStopOrLimitDistance", validationErr.Violations[0].Rule)
+
+	order.StopLevel = Decimal{}
+	order.StopDistance = DecimalFromFloat(12)
+	assert.NoError(t, ValidateOTCWorkingOrder(order, rules))
+}
+
+func TestRoundOTCOrder(t *testing.T) {
+	order := RoundOTCOrder(OTCOrderRequest{Size: DecimalFromFloat(1.2345), StopDistance: DecimalFromFloat(10.04), LimitLevel: DecimalFromFloat(1.123456)}, testDealingRules(), 1)
+	assert.EqualStrings(t, "1.2", order.Size.String())
+	assert.EqualStrings(t, "10", order.StopDistance.String())
+	assert.EqualStrings(t, "1.1", order.LimitLevel.String())
+	assert.EqualStrings(t, "", order.StopLevel.String())
+
+	// Sizes are rounded toward zero, never up to MinDealSize
+	rules := testDealingRules()
+	assert.EqualStrings(t, "2.3", RoundOTCOrder(OTCOrderRequest{Size: DecimalFromFloat(2.37)}, rules, 1).Size.String())
+	assert.EqualStrings(t, "1.7", RoundOTCWorkingOrder(OTCWorkingOrderRequest{Size: DecimalFromFloat(1.74)}, rules, 1).Size.String())
+	small := RoundOTCOrder(OTCOrderRequest{Size: DecimalFromFloat(0.25)}, rules, 1)
+	assert.EqualStrings(t, "0.2", small.Size.String())
+	var validationErr *OrderValidationError
+	assert.True(t, errors.As(ValidateOTCOrder(small, rules, DecimalFromFloat(15000)), &validationErr))
+	assert.EqualStrings(t, "size", validationErr.Violations[0].Field)
+
+	// Without a MinDealSize the size is kept
+	rules.MinDealSize = UnitValueFloat{}
+	assert.EqualStrings(t, "0.5", RoundOTCOrder(OTCOrderRequest{Size: DecimalFromFloat(0.5)}, rules, 1).Size.String())
+	assert.EqualStrings(t, "0.123", RoundOTCWorkingOrder(OTCWorkingOrderRequest{Size: DecimalFromFloat(0.123)}, rules, 1).Size.String())
+}
+
+func TestOrderValidationPreflight(t *testing.T) {
+	var mu sync.Mutex
+	marketRequests, orderRequests := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/gateway/deal/markets/IX.D.DAX.IFD.IP":
+			marketRequests++
+			_, _ = w.Write([]byte(`{"dealingRules":{"minDealSize":{"unit":"POINTS","value":0.5},
+				"minNormalStopOrLimitDistance":{"unit":"POINTS","value":8},
+				"maxStopOrLimitDistance":{"unit":"PERCENTAGE","value":75}},
+				"snapshot":{"bid":15000,"offer":15001,"decimalPlacesFactor":1}}`))
+		case "/gateway/deal/positions/otc":
+			orderRequests++
+			_, _ = w.Write([]byte(`{"dealReference":"REF"}`))
+		}
+	}))
+	defer server.Close()
+
+	igm, err := NewWithOptions(WithBaseURL(server.URL), WithOrderValidation(OrderValidation{MarketCacheTTL: time.Hour, Round: true}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = igm.PlaceOTCOrder(ctx, OTCOrderRequest{Epic: "IX.D.DAX.IFD.IP", Direction: DirectionBuy, Size: DecimalFromFloat(0.2), StopDistance: DecimalFromFloat(5)})
+	assert.True(t, errors.Is(err, ErrInvalidOrder))
+
+	// Rounded to valid steps before validation
+	_, err = igm.PlaceOTCOrder(ctx, OTCOrderRequest{Epic: "IX.D.DAX.IFD.IP", Direction: DirectionBuy, Size: DecimalFromFloat(0.51), StopDistance: DecimalFromFloat(7.96)})
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.EqualInt(t, 1, marketRequests)
+	assert.EqualInt(t, 1, orderRequests)
+}
@@ -54,7 +54,7 @@ func (ig *IGMarkets) DeleteFromWatchlist(ctx context.Context, watchListID, epic
 		return fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	_, err = ig.doRequest(ctx, req, 1, nil)
+	err = ig.doWithoutResponse(ctx, req, 1)
 
 	return err
 }
@@ -72,7 +72,7 @@ func (ig *IGMarkets) AddToWatchlist(ctx context.Context, watchListID, epic strin
 		return fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	_, err = ig.doRequest(ctx, req, 1, nil)
+	err = ig.doWithoutResponse(ctx, req, 1)
 
 	return err
 }
@@ -86,8 +86,7 @@ func (ig *IGMarkets) GetWatchlist(ctx context.Context, watchListID string) (*Wat
 		return &WatchlistData{}, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, WatchlistData{})
-	igResponse, _ := igResponseInterface.(*WatchlistData)
+	igResponse, err := do[WatchlistData](ctx, ig, req, 1)
 
 	return igResponse, err
 }
@@ -101,10 +100,12 @@ func (ig *IGMarkets) GetAllWatchlists(ctx context.Context) (*[]Watchlist, error)
 		return &[]Watchlist{}, fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, WatchlistsResponse{})
-	igResponse, _ := igResponseInterface.(*WatchlistsResponse)
+	igResponse, err := do[WatchlistsResponse](ctx, ig, req, 1)
+	if err != nil {
+		return nil, err
+	}
 
-	return &igResponse.Watchlists, err
+	return &igResponse.Watchlists, nil
 }
 
 // DeleteWatchlist - Delete whole watchlist
@@ -117,7 +118,7 @@ func (ig *IGMarkets) DeleteWatchlist(ctx context.Context, watchListID string) er
 		return fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	_, err = ig.doRequest(ctx, req, 1, nil)
+	err = ig.doWithoutResponse(ctx, req, 1)
 
 	return err
 }
@@ -139,11 +140,10 @@ func (ig *IGMarkets) CreateWatchlist(ctx context.Context, name string, epics []s
 		return "", fmt.Errorf("igmarkets: unable to create HTTP request: %v", err)
 	}
 
-	igResponseInterface, err := ig.doRequest(ctx, req, 1, CreateWatchlistResponse{})
+	igResponse, err := do[CreateWatchlistResponse](ctx, ig, req, 1)
 	if err != nil {
 		return "", err
 	}
-	igResponse, _ := igResponseInterface.(*CreateWatchlistResponse)
 
 	return igResponse.WatchlistID, nil
 }